@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
 	"github.com/craiggwilson/go-typeproviders/pkg/providers/bson"
 	"github.com/spf13/cobra"
 )
@@ -14,45 +14,55 @@ func init() {
 	rootCmd.AddCommand(bsonCmd)
 
 	bsonCmd.Flags().StringP("name", "n", "AutoGenerated", "The name of the struct.")
+	bsonCmd.Flags().BoolP("merge", "", false, "Merge every file into a single struct instead of one struct per file.")
+	bsonCmd.Flags().StringP("discriminator", "", "", "The field used to partition documents into variants.")
 }
 
 var bsonCmd = &cobra.Command{
-	Use:   "bson [filename]",
-	Short: "Generate structs based on a bson file.",
-	Long:  "Generate structs based on a bson file.",
-	Args:  cobra.MaximumNArgs(1),
+	Use:   "bson [filename|glob]...",
+	Short: "Generate structs based on bson files.",
+	Long:  "Generate structs based on bson files.",
 	Run: func(cmd *cobra.Command, args []string) {
 
-		var r io.Reader
-		var structName string
-		if len(args) == 1 {
-			f, err := os.Open(args[0])
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			defer func() {
-				_ = f.Close()
-			}()
-			r = f
-
-			base := filepath.Base(args[0])
-			ext := filepath.Ext(base)
-			structName = base[0 : len(base)-len(ext)]
-		} else {
-			r = os.Stdin
+		inputs, err := openInputs(args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 
-		if structName == "" || cmd.Flags().Lookup("name").Changed {
-			structName = cmd.Flags().Lookup("name").Value.String()
+		err = runBSON(cmd, inputs)
+		closeInputs(inputs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+	},
+}
 
-		cfg := bson.Config{
-			Input:      r,
-			StructName: structName,
-		}
+// runBSON generates the structs of the inputs, which are left open.
+func runBSON(cmd *cobra.Command, inputs []*input) error {
+	merge, structName, fallback, err := nameFlags(cmd)
+	if err != nil {
+		return err
+	}
 
-		p := bson.NewStructProvider(cfg)
-		run(p)
-	},
+	ovs, err := loadOverrides()
+	if err != nil {
+		return err
+	}
+
+	discriminator := cmd.Flags().Lookup("discriminator").Value.String()
+	p, err := inputProviders(inputs, merge, structName, fallback, func(r io.Reader, structName string) generate.StructProvider {
+		return bson.NewStructProvider(bson.Config{
+			Input:         r,
+			StructName:    structName,
+			Discriminator: discriminator,
+			Overrides:     ovs,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return run(p)
 }
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/config"
+	"github.com/craiggwilson/go-typeproviders/pkg/diff"
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+	"github.com/spf13/cobra"
+)
+
+// driftExitCode is the exit code when the schema changed, distinct from the
+// one for errors.
+const driftExitCode = 2
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringP("config", "c", "", "The configuration file. Defaults to the nearest typeprovider.yaml, typeprovider.yml or typeprovider.json.")
+	diffCmd.Flags().StringP("against", "", "", "A Go file or snapshot to compare against instead of the job's output. Requires a single job.")
+	diffCmd.Flags().StringP("save", "", "", "Save a snapshot of the structs inferred now. Requires a single job.")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [job]...",
+	Short: "Compare the structs inferred now against the generated ones.",
+	Long: `Compare the structs inferred now against the generated ones, reporting the
+added and removed fields and the changes of type and nullability. Each job is
+compared against its output file unless another file or snapshot is given.
+Exits with 2 when something changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		jobs, err := selectJobs(cfg, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		against := cmd.Flags().Lookup("against").Value.String()
+		save := cmd.Flags().Lookup("save").Value.String()
+		if (against != "" || save != "") && len(jobs) != 1 {
+			fmt.Println("--against and --save require a single job")
+			os.Exit(1)
+		}
+
+		ctx := signalContext(context.Background())
+		drifted := false
+		for _, job := range jobs {
+			changes, err := diffJob(ctx, cfg, job, against, save)
+			if err != nil {
+				fmt.Printf("%s: %v\n", job.Name, err)
+				os.Exit(1)
+			}
+
+			for _, c := range changes {
+				fmt.Printf("%s: %s\n", job.Name, c)
+				drifted = true
+			}
+		}
+
+		if drifted {
+			os.Exit(driftExitCode)
+		}
+	},
+}
+
+// diffJob compares the structs the job infers now against the ones in the
+// file named by against, or the job's output.
+func diffJob(ctx context.Context, cfg *config.Config, job *config.Job, against string, save string) ([]*diff.Change, error) {
+	if against == "" {
+		against = job.Output
+		if against == "" {
+			against = job.OutputDir
+		}
+		if against == "" {
+			return nil, fmt.Errorf("no output to compare against")
+		}
+		against = cfg.Path(against)
+	}
+
+	p, closer, err := jobProvider(cfg, job)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	pkg := jobPackage(job)
+	if pkg == "" {
+		// the package doesn't matter to the comparison.
+		pkg = "snapshot"
+	}
+
+	src, err := generate.Render(ctx, p, generate.Options{
+		Package:      pkg,
+		EmbedStructs: job.EmbedStructs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := diff.FromSource(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if save != "" {
+		if err := current.Save(save); err != nil {
+			return nil, err
+		}
+	}
+
+	old, err := diff.Load(against)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff.Compare(old, current), nil
+}
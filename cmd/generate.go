@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/config"
+	"github.com/craiggwilson/go-typeproviders/pkg/extjson"
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/bson"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/json"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/mongodb"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/mongodump"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/schemafile"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+
+	generateCmd.Flags().StringP("config", "c", "", "The configuration file. Defaults to the nearest typeprovider.yaml, typeprovider.yml or typeprovider.json.")
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate [job]...",
+	Short: "Run the jobs in the configuration file.",
+	Long:  "Run the jobs in the configuration file, or only the named ones.",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		jobs, err := selectJobs(cfg, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		ctx := signalContext(context.Background())
+		for _, job := range jobs {
+			if err := runJob(ctx, cfg, job); err != nil {
+				fmt.Printf("%s: %v\n", job.Name, err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// loadConfig reads the file named by the config flag, or the nearest one.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	path := cmd.Flags().Lookup("config").Value.String()
+	if path == "" {
+		var err error
+		if path, err = config.Find("."); err != nil {
+			return nil, err
+		}
+	}
+
+	return config.Load(path)
+}
+
+// selectJobs returns the jobs with the given names, or all of them when no
+// names are given.
+func selectJobs(cfg *config.Config, names []string) ([]*config.Job, error) {
+	if len(names) == 0 {
+		return cfg.Jobs, nil
+	}
+
+	var jobs []*config.Job
+	for _, name := range names {
+		found := false
+		for _, job := range cfg.Jobs {
+			if job.Name == name {
+				jobs = append(jobs, job)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no job named %s", name)
+		}
+	}
+
+	return jobs, nil
+}
+
+func runJob(ctx context.Context, cfg *config.Config, job *config.Job) error {
+	pkg := jobPackage(job)
+	if pkg == "" {
+		return fmt.Errorf("no package")
+	}
+
+	p, closer, err := jobProvider(cfg, job)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	if path, accumulate := jobSchemaPath(job); path != "" {
+		// the structs are built from the saved schema rather than inferring
+		// them twice.
+		sch, err := saveSchema(ctx, p, cfg.Path(path), accumulate)
+		if err != nil {
+			return err
+		}
+
+		ovs, err := jobOverrides(cfg, job)
+		if err != nil {
+			return err
+		}
+		p = schemafile.NewStructProvider(schemafile.Config{
+			Schema:    sch,
+			TagNames:  job.Tags,
+			Overrides: ovs,
+		})
+	}
+
+	opts, err := jobOptions(job)
+	if err != nil {
+		return err
+	}
+	opts.Package = pkg
+
+	switch {
+	case job.OutputDir != "":
+		return generate.GenerateDir(ctx, p, cfg.Path(job.OutputDir), opts)
+	case job.Output != "":
+		return generate.GenerateFile(ctx, p, cfg.Path(job.Output), opts)
+	default:
+		return generate.Generate(ctx, p, opts)
+	}
+}
+
+// jobOptions returns the generation options of the job, other than the
+// package.
+func jobOptions(job *config.Job) (generate.Options, error) {
+	opts := generate.Options{
+		EmbedStructs: job.EmbedStructs,
+		OmitEmpty:    job.OmitEmpty,
+		Header:       job.Header,
+		Merge:        job.MergeExisting,
+	}
+
+	var err error
+	if opts.FieldOrder, err = generate.ParseFieldOrder(job.FieldOrder); err != nil {
+		return opts, err
+	}
+	if opts.Format, err = generate.ParseFormat(job.Format); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// jobSchemaPath returns the file the job saves its schema to, if any, and
+// whether the schema accumulates there across runs.
+func jobSchemaPath(job *config.Job) (string, bool) {
+	if job.State != "" {
+		return job.State, true
+	}
+
+	return job.SchemaOutput, false
+}
+
+// jobPackage returns the name of the package holding the job's structs.
+func jobPackage(job *config.Job) string {
+	if job.Package != "" {
+		return job.Package
+	}
+
+	// go generate names the package of the file holding the directive.
+	return os.Getenv("GOPACKAGE")
+}
+
+// jobProvider makes the provider for a job, along with a function closing
+// the inputs it reads once done.
+func jobProvider(cfg *config.Config, job *config.Job) (generate.StructProvider, func(), error) {
+	ovs, err := jobOverrides(cfg, job)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch job.Provider {
+	case "bson", "json", "schema":
+		if len(job.Inputs) == 0 {
+			return nil, nil, fmt.Errorf("no inputs")
+		}
+
+		patterns := make([]string, 0, len(job.Inputs))
+		for _, input := range job.Inputs {
+			patterns = append(patterns, cfg.Path(input))
+		}
+
+		inputs, err := openInputs(patterns)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p, err := fileProvider(job, inputs, ovs)
+		if err != nil {
+			closeInputs(inputs)
+			return nil, nil, err
+		}
+
+		return p, func() { closeInputs(inputs) }, nil
+	case "mongodb":
+		p, err := mongodbProvider(cfg, job, ovs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return p, func() {}, nil
+	case "mongodump":
+		if len(job.Inputs) != 1 {
+			return nil, nil, fmt.Errorf("mongodump requires a single input directory")
+		}
+
+		p := mongodump.NewStructProvider(mongodump.Config{
+			Dir:           cfg.Path(job.Inputs[0]),
+			Discriminator: job.Discriminator,
+			Indexes:       job.Indexes,
+			TagNames:      job.Tags,
+			Overrides:     ovs,
+		})
+
+		return p, func() {}, nil
+	default:
+		return registeredProvider(cfg, job, ovs)
+	}
+}
+
+// registeredProvider makes the provider for a job using a registered
+// provider, with the job's options as its flags and its inputs as its
+// arguments.
+func registeredProvider(cfg *config.Config, job *config.Job, ovs overrides.Set) (generate.StructProvider, func(), error) {
+	rp := generate.LookupProvider(job.Provider)
+	if rp == nil {
+		return nil, nil, fmt.Errorf("unknown provider %q", job.Provider)
+	}
+
+	fs := rp.FlagSet()
+	for name, value := range job.Options {
+		if err := fs.Set(name, value); err != nil {
+			return nil, nil, fmt.Errorf("option %s: %v", name, err)
+		}
+	}
+
+	args := make([]string, 0, len(job.Inputs))
+	for _, input := range job.Inputs {
+		args = append(args, cfg.Path(input))
+	}
+
+	p, err := rp.New(&generate.ProviderContext{
+		Flags:     fs,
+		Args:      args,
+		Overrides: ovs,
+		TagNames:  job.Tags,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closer := func() {}
+	if c, ok := p.(io.Closer); ok {
+		closer = func() {
+			_ = c.Close()
+		}
+	}
+
+	return p, closer, nil
+}
+
+// jobOverrides reads the job's overrides file, if any.
+func jobOverrides(cfg *config.Config, job *config.Job) (overrides.Set, error) {
+	if job.Overrides == "" {
+		return nil, nil
+	}
+
+	return overrides.Load(cfg.Path(job.Overrides))
+}
+
+// fileProvider makes the provider for a bson, json or schema job.
+func fileProvider(job *config.Job, inputs []*input, ovs overrides.Set) (generate.StructProvider, error) {
+	switch job.Provider {
+	case "schema":
+		var ps multiProvider
+		for _, in := range inputs {
+			ps = append(ps, schemafile.NewStructProvider(schemafile.Config{
+				Input:     in,
+				TagNames:  job.Tags,
+				Overrides: ovs,
+			}))
+		}
+		return ps, nil
+	case "bson":
+		return inputProviders(inputs, job.Merge, job.StructName, "", func(r io.Reader, structName string) generate.StructProvider {
+			return bson.NewStructProvider(bson.Config{
+				Input:         r,
+				StructName:    structName,
+				Discriminator: job.Discriminator,
+				TagNames:      job.Tags,
+				Overrides:     ovs,
+			})
+		})
+	}
+
+	mode := extjson.ModeAuto
+	if job.Mode != "" {
+		var err error
+		if mode, err = extjson.ParseMode(job.Mode); err != nil {
+			return nil, err
+		}
+	}
+
+	return inputProviders(inputs, job.Merge, job.StructName, "", func(r io.Reader, structName string) generate.StructProvider {
+		return json.NewStructProvider(json.Config{
+			Input:         r,
+			StructName:    structName,
+			Discriminator: job.Discriminator,
+			Mode:          mode,
+			TagNames:      job.Tags,
+			Overrides:     ovs,
+		})
+	})
+}
+
+// mongodbProvider makes the provider for a mongodb job, using the same
+// defaults as the mongodb command.
+func mongodbProvider(cfg *config.Config, job *config.Job, ovs overrides.Set) (generate.StructProvider, error) {
+	mcfg := mongodb.Config{
+		URI:                    job.URI,
+		DatabaseName:           job.Database,
+		CollectionName:         job.Collection,
+		SampleSize:             defaultSampleSize,
+		BatchSize:              job.BatchSize,
+		Discriminator:          job.Discriminator,
+		RecentBy:               job.RecentBy,
+		DateField:              job.DateField,
+		Progress:               os.Stderr,
+		ReadPreference:         job.ReadPreference,
+		TLSCAFile:              cfg.Path(job.TLSCAFile),
+		TLSCertificateKeyFile:  cfg.Path(job.TLSCertificateKeyFile),
+		AuthMechanism:          job.AuthMechanism,
+		AppName:                job.AppName,
+		ServerSelectionTimeout: defaultServerSelectionTimeout,
+		Indexes:                job.Indexes,
+		Include:                job.Include,
+		Exclude:                job.Exclude,
+		TagNames:               job.Tags,
+		Overrides:              ovs,
+	}
+	if mcfg.URI == "" {
+		mcfg.URI = defaultURI
+	}
+	if mcfg.AppName == "" {
+		mcfg.AppName = defaultAppName
+	}
+	if mcfg.DatabaseName == "" {
+		return nil, fmt.Errorf("no database")
+	}
+	if job.SampleSize != nil {
+		mcfg.SampleSize = *job.SampleSize
+	}
+
+	var err error
+	if mcfg.Filter, err = parseExtJSON("filter", job.Filter); err != nil {
+		return nil, err
+	}
+	if mcfg.Projection, err = parseExtJSON("projection", job.Projection); err != nil {
+		return nil, err
+	}
+	if job.ServerSelectionTimeout != "" {
+		if mcfg.ServerSelectionTimeout, err = time.ParseDuration(job.ServerSelectionTimeout); err != nil {
+			return nil, fmt.Errorf("invalid serverSelectionTimeout: %v", err)
+		}
+	}
+	if job.OperationTimeout != "" {
+		if mcfg.OperationTimeout, err = time.ParseDuration(job.OperationTimeout); err != nil {
+			return nil, fmt.Errorf("invalid operationTimeout: %v", err)
+		}
+	}
+	if err := setDateWindow(&mcfg, job.Since, job.Until); err != nil {
+		return nil, err
+	}
+
+	return mongodb.NewStructProvider(mcfg), nil
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/decompress"
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/spf13/cobra"
+)
+
+// input is an input, decompressed when needed, along with the struct name
+// derived from its filename. A file is only opened when it's first read and
+// is closed once read to the end, so that a large glob doesn't hold a file
+// open for each of its matches.
+type input struct {
+	filename   string
+	structName string
+
+	r    io.ReadCloser
+	done bool
+}
+
+func (in *input) Read(p []byte) (int, error) {
+	if in.done {
+		return 0, io.EOF
+	}
+	if in.r == nil {
+		r, err := decompress.Open(in.filename)
+		if err != nil {
+			return 0, err
+		}
+		in.r = r
+	}
+
+	n, err := in.r.Read(p)
+	if err == io.EOF {
+		in.done = true
+		if cerr := in.Close(); cerr != nil {
+			return n, cerr
+		}
+	}
+	return n, err
+}
+
+func (in *input) Close() error {
+	if in.r == nil {
+		return nil
+	}
+
+	err := in.r.Close()
+	in.r = nil
+	return err
+}
+
+// openInputs prepares the files named in args, expanding glob patterns, or
+// stdin when there are none.
+func openInputs(args []string) ([]*input, error) {
+	if len(args) == 0 {
+		r, err := decompress.NewReader(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []*input{{r: r}}, nil
+	}
+
+	filenames, err := expandGlobs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []*input
+	for _, filename := range filenames {
+		// missing files are reported now rather than once reading started.
+		if _, err := os.Stat(filename); err != nil {
+			return nil, err
+		}
+
+		base := decompress.TrimExt(filepath.Base(filename))
+		ext := filepath.Ext(base)
+		inputs = append(inputs, &input{
+			filename:   filename,
+			structName: base[0 : len(base)-len(ext)],
+		})
+	}
+
+	return inputs, nil
+}
+
+func closeInputs(inputs []*input) {
+	for _, in := range inputs {
+		_ = in.Close()
+	}
+}
+
+// expandGlobs replaces each pattern with the files it matches. Patterns
+// matching nothing are kept so opening them reports the missing file.
+func expandGlobs(patterns []string) ([]string, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{pattern}
+		}
+
+		filenames = append(filenames, matches...)
+	}
+
+	return filenames, nil
+}
+
+// inputProviders makes the providers for the inputs: a single provider of one
+// struct when merging, or else a provider for each input. A non-empty
+// structName overrides the names derived from the filenames, and fallback
+// names the struct read from stdin.
+func inputProviders(inputs []*input, merge bool, structName string, fallback string, newProvider func(r io.Reader, structName string) generate.StructProvider) (generate.StructProvider, error) {
+	if merge || len(inputs) == 1 {
+		if structName == "" {
+			structName = inputs[0].structName
+		}
+		if structName == "" {
+			structName = fallback
+		}
+
+		readers := make([]io.Reader, 0, len(inputs))
+		for _, in := range inputs {
+			readers = append(readers, in)
+		}
+
+		return newProvider(io.MultiReader(readers...), structName), nil
+	}
+
+	if structName != "" {
+		return nil, fmt.Errorf("a struct name requires merging when there are several files")
+	}
+
+	names := make(naming.StructNames)
+	var ps multiProvider
+	for _, in := range inputs {
+		if err := names.Add(in.filename, in.structName); err != nil {
+			return nil, fmt.Errorf("%v; merge them or rename one", err)
+		}
+
+		ps = append(ps, newProvider(in, in.structName))
+	}
+
+	return ps, nil
+}
+
+// nameFlags reads the merge and name flags shared by the file commands.
+func nameFlags(cmd *cobra.Command) (merge bool, structName string, fallback string, err error) {
+	merge, err = strconv.ParseBool(cmd.Flags().Lookup("merge").Value.String())
+	if err != nil {
+		return false, "", "", err
+	}
+
+	nameFlag := cmd.Flags().Lookup("name")
+	if nameFlag.Changed {
+		structName = nameFlag.Value.String()
+	}
+
+	return merge, structName, nameFlag.Value.String(), nil
+}
+
+// multiProvider provides the structs of each of its providers in turn.
+type multiProvider []generate.StructProvider
+
+func (mp multiProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
+	var results []*structbuilder.Struct
+	for _, p := range mp {
+		structs, err := p.ProvideStructs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, structs...)
+	}
+
+	return results, nil
+}
+
+func (mp multiProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
+	result := &schema.Schema{Version: schema.Version}
+	for _, p := range mp {
+		sp, ok := p.(schema.Provider)
+		if !ok {
+			return nil, fmt.Errorf("the provider cannot save a schema")
+		}
+
+		s, err := sp.ProvideSchema(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Collections = append(result.Collections, s.Collections...)
+	}
+
+	return result, nil
+}
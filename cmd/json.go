@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 
+	"github.com/craiggwilson/go-typeproviders/pkg/extjson"
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
 	"github.com/craiggwilson/go-typeproviders/pkg/providers/json"
 	"github.com/spf13/cobra"
 )
@@ -14,45 +15,62 @@ func init() {
 	rootCmd.AddCommand(jsonCmd)
 
 	jsonCmd.Flags().StringP("name", "n", "AutoGenerated", "The name of the struct.")
+	jsonCmd.Flags().BoolP("merge", "", false, "Merge every file into a single struct instead of one struct per file.")
+	jsonCmd.Flags().StringP("discriminator", "", "", "The field used to partition documents into variants.")
+	jsonCmd.Flags().StringP("mode", "", string(extjson.ModeAuto), "The flavor of JSON: auto, canonical, relaxed or shell (including legacy mongoexport) Extended JSON, or plain for ordinary JSON.")
 }
 
 var jsonCmd = &cobra.Command{
-	Use:   "json [filename]",
-	Short: "Generate structs based on a json file.",
-	Long:  "Generate structs based on a json file.",
-	Args:  cobra.MaximumNArgs(1),
+	Use:   "json [filename|glob]...",
+	Short: "Generate structs based on json files.",
+	Long:  "Generate structs based on json files.",
 	Run: func(cmd *cobra.Command, args []string) {
 
-		var r io.Reader
-		var structName string
-		if len(args) == 1 {
-			f, err := os.Open(args[0])
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			defer func() {
-				_ = f.Close()
-			}()
-			r = f
-
-			base := filepath.Base(args[0])
-			ext := filepath.Ext(base)
-			structName = base[0 : len(base)-len(ext)]
-		} else {
-			r = os.Stdin
+		inputs, err := openInputs(args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 
-		if structName == "" || cmd.Flags().Lookup("name").Changed {
-			structName = cmd.Flags().Lookup("name").Value.String()
+		err = runJSON(cmd, inputs)
+		closeInputs(inputs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+	},
+}
 
-		cfg := json.Config{
-			Input:      r,
-			StructName: structName,
-		}
+// runJSON generates the structs of the inputs, which are left open.
+func runJSON(cmd *cobra.Command, inputs []*input) error {
+	mode, err := extjson.ParseMode(cmd.Flags().Lookup("mode").Value.String())
+	if err != nil {
+		return err
+	}
 
-		p := json.NewStructProvider(cfg)
-		run(p)
-	},
+	merge, structName, fallback, err := nameFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	ovs, err := loadOverrides()
+	if err != nil {
+		return err
+	}
+
+	discriminator := cmd.Flags().Lookup("discriminator").Value.String()
+	p, err := inputProviders(inputs, merge, structName, fallback, func(r io.Reader, structName string) generate.StructProvider {
+		return json.NewStructProvider(json.Config{
+			Input:         r,
+			StructName:    structName,
+			Discriminator: discriminator,
+			Overrides:     ovs,
+			Mode:          mode,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return run(p)
 }
@@ -1,19 +1,50 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/craiggwilson/go-typeproviders/pkg/providers/mongodb"
+	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/spf13/cobra"
 )
 
+// The defaults of the mongodb command, which mongodb jobs share.
+const (
+	defaultURI                    = "mongodb://localhost:27017"
+	defaultSampleSize             = 100
+	defaultAppName                = "typeprovider"
+	defaultServerSelectionTimeout = 30 * time.Second
+)
+
 func init() {
 	rootCmd.AddCommand(mongodbCmd)
 
-	mongodbCmd.Flags().StringP("uri", "u", "mongodb://localhost:27017", "The mongodb URI to read from.")
+	mongodbCmd.Flags().StringP("uri", "u", defaultURI, "The mongodb URI to read from.")
 	mongodbCmd.Flags().StringP("database", "d", "", "The mongodb database to use.")
 	mongodbCmd.Flags().StringP("collection", "c", "", "The mongodb collection to use.")
-	mongodbCmd.Flags().UintP("sampleSize", "", 100, "The sampling size. 0 indicates to do a full collection scan.")
+	mongodbCmd.Flags().UintP("sampleSize", "", defaultSampleSize, "The sampling size. 0 indicates to do a full collection scan.")
+	mongodbCmd.Flags().Int32P("batchSize", "", 0, "The number of documents fetched at a time during a full collection scan. 0 uses the server's default.")
+	mongodbCmd.Flags().StringP("discriminator", "", "", "The field used to partition documents into variants.")
+	mongodbCmd.Flags().StringP("filter", "", "", "An extended JSON query limiting the documents sampled.")
+	mongodbCmd.Flags().StringP("projection", "", "", "An extended JSON projection limiting the fields sampled.")
+	mongodbCmd.Flags().StringP("recentBy", "", "", "Sample the most recent documents by this field instead of random ones.")
+	mongodbCmd.Flags().StringP("dateField", "", "", "The date field used by since and until.")
+	mongodbCmd.Flags().StringP("since", "", "", "Only sample documents on or after this RFC3339 time or duration ago (e.g. 720h).")
+	mongodbCmd.Flags().StringP("until", "", "", "Only sample documents before this RFC3339 time or duration ago (e.g. 24h).")
+
+	mongodbCmd.Flags().BoolP("indexes", "", false, "Generate an Indexes method returning the indexes deployed on each collection.")
+	mongodbCmd.Flags().StringSliceP("include", "", nil, "Glob patterns of the collections to use when no collection is given.")
+	mongodbCmd.Flags().StringSliceP("exclude", "", nil, "Glob patterns of the collections to skip when no collection is given.")
+	mongodbCmd.Flags().StringP("readPreference", "", "", "The read preference mode, such as secondaryPreferred to sample from secondaries.")
+	mongodbCmd.Flags().StringP("tlsCAFile", "", "", "The certificate authority file used to enable TLS.")
+	mongodbCmd.Flags().StringP("tlsCertificateKeyFile", "", "", "The client certificate and key file used to enable TLS.")
+	mongodbCmd.Flags().StringP("authMechanism", "", "", "The authentication mechanism, such as SCRAM-SHA-256 or MONGODB-X509.")
+	mongodbCmd.Flags().StringP("appName", "", defaultAppName, "The application name reported to the server.")
+	mongodbCmd.Flags().DurationP("serverSelectionTimeout", "", defaultServerSelectionTimeout, "How long to wait for a suitable server.")
+	mongodbCmd.Flags().DurationP("operationTimeout", "", 0, "How long to wait on any single network operation. 0 waits indefinitely.")
 
 	mongodbCmd.MarkFlagRequired("database")
 }
@@ -25,15 +56,125 @@ var mongodbCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		sampleSize, _ := strconv.ParseUint(cmd.Flags().Lookup("sampleSize").Value.String(), 10, 32)
+		batchSize, _ := strconv.ParseInt(cmd.Flags().Lookup("batchSize").Value.String(), 10, 32)
 
 		cfg := mongodb.Config{
 			URI:            cmd.Flags().Lookup("uri").Value.String(),
 			DatabaseName:   cmd.Flags().Lookup("database").Value.String(),
 			CollectionName: cmd.Flags().Lookup("collection").Value.String(),
 			SampleSize:     uint(sampleSize),
+			BatchSize:      int32(batchSize),
+			Progress:       os.Stderr,
+			Discriminator:  cmd.Flags().Lookup("discriminator").Value.String(),
+			RecentBy:       cmd.Flags().Lookup("recentBy").Value.String(),
+			DateField:      cmd.Flags().Lookup("dateField").Value.String(),
+
+			ReadPreference:        cmd.Flags().Lookup("readPreference").Value.String(),
+			TLSCAFile:             cmd.Flags().Lookup("tlsCAFile").Value.String(),
+			TLSCertificateKeyFile: cmd.Flags().Lookup("tlsCertificateKeyFile").Value.String(),
+			AuthMechanism:         cmd.Flags().Lookup("authMechanism").Value.String(),
+			AppName:               cmd.Flags().Lookup("appName").Value.String(),
+		}
+
+		var err error
+		if cfg.Overrides, err = loadOverrides(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.Indexes, err = strconv.ParseBool(cmd.Flags().Lookup("indexes").Value.String()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.Include, err = cmd.Flags().GetStringSlice("include"); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.Exclude, err = cmd.Flags().GetStringSlice("exclude"); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.Filter, err = parseExtJSONFlag(cmd, "filter"); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.Projection, err = parseExtJSONFlag(cmd, "projection"); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.ServerSelectionTimeout, err = time.ParseDuration(cmd.Flags().Lookup("serverSelectionTimeout").Value.String()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if cfg.OperationTimeout, err = time.ParseDuration(cmd.Flags().Lookup("operationTimeout").Value.String()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := setDateWindow(&cfg, cmd.Flags().Lookup("since").Value.String(), cmd.Flags().Lookup("until").Value.String()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 
 		p := mongodb.NewStructProvider(cfg)
-		run(p)
+		if err := run(p); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	},
 }
+
+func parseExtJSONFlag(cmd *cobra.Command, name string) (*bson.Document, error) {
+	return parseExtJSON(name, cmd.Flags().Lookup(name).Value.String())
+}
+
+// parseExtJSON parses the named extended JSON setting, which may be empty.
+func parseExtJSON(name string, value string) (*bson.Document, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	doc, err := bson.ParseExtJSONObject(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return doc, nil
+}
+
+// setDateWindow sets the window of the sampled documents' dates from the
+// since and until settings.
+func setDateWindow(cfg *mongodb.Config, since string, until string) error {
+	now := time.Now()
+
+	var err error
+	if cfg.Since, err = parseTime("since", since, now); err != nil {
+		return err
+	}
+	if cfg.Until, err = parseTime("until", until, now); err != nil {
+		return err
+	}
+
+	if cfg.DateField == "" && (!cfg.Since.IsZero() || !cfg.Until.IsZero()) {
+		return fmt.Errorf("since and until require dateField")
+	}
+
+	return nil
+}
+
+// parseTime parses the named setting holding either an RFC3339 time or a
+// duration before now, which may be empty.
+func parseTime(name string, value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected an RFC3339 time or a duration", name)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/mongodump"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(mongodumpCmd)
+
+	mongodumpCmd.Flags().StringP("discriminator", "", "", "The field used to partition documents into variants.")
+	mongodumpCmd.Flags().BoolP("indexes", "", false, "Generate an Indexes method returning the indexes recorded for each collection.")
+}
+
+var mongodumpCmd = &cobra.Command{
+	Use:   "mongodump [dir]",
+	Short: "Generate structs based on the output of mongodump.",
+	Long:  "Generate a struct for each collection in the output of mongodump, using the validators and indexes in its metadata.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		indexes, err := strconv.ParseBool(cmd.Flags().Lookup("indexes").Value.String())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		ovs, err := loadOverrides()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		cfg := mongodump.Config{
+			Dir:           args[0],
+			Discriminator: cmd.Flags().Lookup("discriminator").Value.String(),
+			Indexes:       indexes,
+			Overrides:     ovs,
+		}
+
+		p := mongodump.NewStructProvider(cfg)
+		if err := run(p); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+	"github.com/spf13/cobra"
+)
+
+// addProviderCommands adds a command for each registered provider whose name
+// isn't already taken by a command.
+func addProviderCommands() {
+	for _, p := range generate.Providers() {
+		if hasCommand(p.Name) {
+			continue
+		}
+
+		rootCmd.AddCommand(providerCommand(p))
+	}
+}
+
+func hasCommand(name string) bool {
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func providerCommand(p *generate.Provider) *cobra.Command {
+	c := &cobra.Command{
+		Use:   strings.TrimSpace(p.Name + " " + p.Usage),
+		Short: p.Short,
+		Long:  p.Long,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			ovs, err := loadOverrides()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			sp, err := p.New(&generate.ProviderContext{
+				Flags:     cmd.Flags(),
+				Args:      args,
+				Overrides: ovs,
+			})
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = run(sp)
+			if closer, ok := sp.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	if p.Flags != nil {
+		p.Flags(c.Flags())
+	}
+
+	return c
+}
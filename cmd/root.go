@@ -4,16 +4,27 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringP("pkg", "", "", "the name of the package to hold the structs")
 	rootCmd.PersistentFlags().BoolP("embedStructs", "", false, "embed structs instead of giving them names")
+	rootCmd.PersistentFlags().StringP("fieldOrder", "", string(generate.FieldOrderData), "the order of the fields: data, as first seen, or name")
+	rootCmd.PersistentFlags().BoolP("omitEmpty", "", false, "add omitempty to the tags of pointers, slices and maps")
+	rootCmd.PersistentFlags().StringP("header", "", "", "the comment at the top of the generated file")
+	rootCmd.PersistentFlags().StringP("format", "", string(generate.FormatGo), "the output format: go, gounformatted or json")
+	rootCmd.PersistentFlags().StringP("outDir", "", "", "write a file for each struct to this directory instead of writing to stdout")
+	rootCmd.PersistentFlags().StringP("overrides", "", "", "a yaml or json file of names, types, tags and exclusions keyed by dotted field path")
+	rootCmd.PersistentFlags().StringP("schema", "", "", "save the inferred schema to this json file instead of generating code")
+	rootCmd.PersistentFlags().StringP("state", "", "", "a json file accumulating the schemas inferred across runs, which the structs are generated from")
 }
 
-// Execute starts the application using the provided arguments.
+// Execute starts the application using the provided arguments. Providers
+// registered with generate.RegisterProvider have commands of their own.
 func Execute(args []string) {
+	addProviderCommands()
 	rootCmd.SetArgs(args)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -1,29 +1,177 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 
 	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/schemafile"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
 )
 
-func run(p generate.StructProvider) {
+// run generates the structs of the provider as the root flags ask, saving
+// its schema instead when the schema flag is set.
+func run(p generate.StructProvider) error {
 
 	ctx := signalContext(context.Background())
-	pkg := rootCmd.PersistentFlags().Lookup("pkg").Value.String()
-	embedStructs, err := strconv.ParseBool(rootCmd.PersistentFlags().Lookup("embedStructs").Value.String())
+	state := rootCmd.PersistentFlags().Lookup("state").Value.String()
+	if path := rootCmd.PersistentFlags().Lookup("schema").Value.String(); path != "" {
+		if state != "" {
+			return fmt.Errorf("the schema and state flags can't be used together")
+		}
+
+		_, err := saveSchema(ctx, p, path, false)
+		return err
+	}
+
+	if state != "" {
+		s, err := saveSchema(ctx, p, state, true)
+		if err != nil {
+			return err
+		}
+
+		ovs, err := loadOverrides()
+		if err != nil {
+			return err
+		}
+		p = schemafile.NewStructProvider(schemafile.Config{
+			Schema:    s,
+			Overrides: ovs,
+		})
+	}
+
+	opts, err := options()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if dir := rootCmd.PersistentFlags().Lookup("outDir").Value.String(); dir != "" {
+		return generate.GenerateDir(ctx, p, dir, opts)
+	}
+
+	return generate.Generate(ctx, p, opts)
+}
+
+// options reads the generation options from the root flags.
+func options() (generate.Options, error) {
+	flags := rootCmd.PersistentFlags()
+	opts := generate.Options{
+		Package: flags.Lookup("pkg").Value.String(),
+		Header:  flags.Lookup("header").Value.String(),
 	}
-	err = generate.Generate(ctx, p, "", pkg, embedStructs)
+
+	var err error
+	if opts.EmbedStructs, err = strconv.ParseBool(flags.Lookup("embedStructs").Value.String()); err != nil {
+		return opts, err
+	}
+	if opts.OmitEmpty, err = strconv.ParseBool(flags.Lookup("omitEmpty").Value.String()); err != nil {
+		return opts, err
+	}
+	if opts.FieldOrder, err = generate.ParseFieldOrder(flags.Lookup("fieldOrder").Value.String()); err != nil {
+		return opts, err
+	}
+	if opts.Format, err = generate.ParseFormat(flags.Lookup("format").Value.String()); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// saveSchema writes the schema inferred by the provider to the file. When
+// accumulating, the schema is first merged into the one already saved there.
+func saveSchema(ctx context.Context, p generate.StructProvider, path string, accumulate bool) (*schema.Schema, error) {
+	sp, ok := p.(schema.Provider)
+	if !ok {
+		return nil, fmt.Errorf("the provider cannot save a schema")
+	}
+
+	s, err := sp.ProvideSchema(ctx)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
+
+	if accumulate {
+		prev, err := readSchema(path)
+		switch {
+		case err == nil:
+			if err := schemafile.Merge(prev, s); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			s = prev
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		return nil, err
+	}
+	if err := replaceFile(path, buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// replaceFile writes the data to a temporary file next to path and renames it
+// over path, so that an interrupted write never leaves a truncated file.
+func replaceFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by their owner.
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+
+	return err
+}
+
+func readSchema(path string) (*schema.Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s, err := schema.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return s, nil
+}
+
+// loadOverrides reads the file named by the overrides flag, if any.
+func loadOverrides() (overrides.Set, error) {
+	path := rootCmd.PersistentFlags().Lookup("overrides").Value.String()
+	if path == "" {
+		return nil, nil
+	}
+
+	return overrides.Load(path)
 }
 
 func signalContext(ctx context.Context) context.Context {
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/providers/schemafile"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [filename|glob]...",
+	Short: "Generate structs based on saved schemas.",
+	Long:  "Generate structs based on schemas saved with the schema flag, without reading the data again.",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		inputs, err := openInputs(args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = runSchema(inputs)
+		closeInputs(inputs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// runSchema generates the structs of the inputs, which are left open.
+func runSchema(inputs []*input) error {
+	ovs, err := loadOverrides()
+	if err != nil {
+		return err
+	}
+
+	var p multiProvider
+	for _, in := range inputs {
+		p = append(p, schemafile.NewStructProvider(schemafile.Config{
+			Input:     in,
+			Overrides: ovs,
+		}))
+	}
+
+	return run(p)
+}
@@ -1,18 +1,26 @@
 module github.com/craiggwilson/go-typeproviders
 
+go 1.13
+
 require (
-	github.com/buger/jsonparser v0.0.0-20180910192245-6acdf747ae99 // indirect
 	github.com/c9s/inflect v0.0.0-20130402162822-006c50878f3f
+	github.com/klauspost/compress v1.10.3
+	github.com/mongodb/mongo-go-driver v0.0.15
+	github.com/spf13/cobra v0.0.3
+	github.com/spf13/pflag v1.0.3
+	gopkg.in/yaml.v2 v2.2.8
+)
+
+require (
+	github.com/buger/jsonparser v0.0.0-20180910192245-6acdf747ae99 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/mongodb/mongo-go-driver v0.0.15
-	github.com/spf13/cobra v0.0.3
-	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c // indirect
 	github.com/xdg/stringprep v1.0.0 // indirect
 	golang.org/x/crypto v0.0.0-20181009213950-7c1a557ab941 // indirect
 	golang.org/x/net v0.0.0-20181005035420-146acd28ed58 // indirect
 	golang.org/x/sync v0.0.0-20180314180146-1d60e4601c6f // indirect
 	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
 )
@@ -0,0 +1,211 @@
+// Package config reads the project configuration file declaring the
+// generation jobs of a repository.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Filenames are the names of the configuration file, in the order they are
+// looked for.
+var Filenames = []string{"typeprovider.yaml", "typeprovider.yml", "typeprovider.json"}
+
+// Config holds the jobs of a project.
+type Config struct {
+	Jobs []*Job `yaml:"jobs" json:"jobs"`
+
+	// Dir is the directory holding the configuration file, which relative
+	// paths are resolved against.
+	Dir string `yaml:"-" json:"-"`
+}
+
+// Job describes the generation of a single file.
+type Job struct {
+	// Name identifies the job when running only some of them.
+	Name string `yaml:"name" json:"name"`
+	// Provider is the kind of input: bson, json, mongodb, mongodump, schema
+	// or the name of a registered provider.
+	Provider string `yaml:"provider" json:"provider"`
+	// Options are the values of a registered provider's flags, keyed by the
+	// flag's name.
+	Options map[string]string `yaml:"options" json:"options"`
+	// Inputs are the files or glob patterns read by the bson, json and schema
+	// providers, or the dump directory read by the mongodump provider. A
+	// registered provider gets them as its arguments. Relative paths are
+	// resolved against the configuration file's directory.
+	Inputs []string `yaml:"inputs" json:"inputs"`
+	// StructName names the struct, overriding the name derived from the
+	// input's filename.
+	StructName string `yaml:"structName" json:"structName"`
+	// Merge merges every input into a single struct.
+	Merge bool `yaml:"merge" json:"merge"`
+	// Package is the name of the package holding the structs.
+	Package string `yaml:"package" json:"package"`
+	// Output is the file written. Empty writes to stdout.
+	Output string `yaml:"output" json:"output"`
+	// OutputDir is a directory receiving a file for each struct instead of a
+	// single output file, such as orders.go for the orders collection.
+	OutputDir string `yaml:"outputDir" json:"outputDir"`
+	// SchemaOutput is a file the inferred schema is saved to, which the
+	// schema provider can generate from later without reading the data
+	// again.
+	SchemaOutput string `yaml:"schemaOutput" json:"schemaOutput"`
+	// State is a schema file accumulating what is inferred across runs, so
+	// that repeated samples build up a complete picture. The structs are
+	// generated from the accumulated schema.
+	State string `yaml:"state" json:"state"`
+	// MergeExisting updates an existing output file rather than replacing
+	// it, keeping the methods, comments and typeprovider:keep fields added by
+	// hand.
+	MergeExisting bool `yaml:"mergeExisting" json:"mergeExisting"`
+	// EmbedStructs embeds structs instead of giving them names.
+	EmbedStructs bool `yaml:"embedStructs" json:"embedStructs"`
+	// FieldOrder is the order of the fields: data, as first seen, or name.
+	FieldOrder string `yaml:"fieldOrder" json:"fieldOrder"`
+	// OmitEmpty adds omitempty to the tags of pointers, slices and maps.
+	OmitEmpty bool `yaml:"omitEmpty" json:"omitEmpty"`
+	// Header is the comment at the top of the generated file.
+	Header string `yaml:"header" json:"header"`
+	// Format is the output format: go, gounformatted or json.
+	Format string `yaml:"format" json:"format"`
+	// Tags are the struct tags given to each field, such as bson and json.
+	Tags []string `yaml:"tags" json:"tags"`
+	// Overrides is a file of names, types, tags and exclusions keyed by
+	// dotted field path.
+	Overrides string `yaml:"overrides" json:"overrides"`
+	// Discriminator is the field used to partition documents into variants.
+	Discriminator string `yaml:"discriminator" json:"discriminator"`
+	// Mode is the flavor of JSON read by the json provider.
+	Mode string `yaml:"mode" json:"mode"`
+	// Indexes generates an Indexes method for the mongodb and mongodump
+	// providers.
+	Indexes bool `yaml:"indexes" json:"indexes"`
+
+	// URI, Database and Collection locate the data read by the mongodb
+	// provider. Without a collection, every collection matching Include and
+	// not Exclude is used.
+	URI        string   `yaml:"uri" json:"uri"`
+	Database   string   `yaml:"database" json:"database"`
+	Collection string   `yaml:"collection" json:"collection"`
+	Include    []string `yaml:"include" json:"include"`
+	Exclude    []string `yaml:"exclude" json:"exclude"`
+	// SampleSize is the number of documents sampled by the mongodb provider.
+	// 0 scans the whole collection, and nil uses the default of 100.
+	SampleSize *uint `yaml:"sampleSize" json:"sampleSize"`
+	// Filter and Projection are extended JSON limiting the documents and
+	// fields sampled by the mongodb provider.
+	Filter     string `yaml:"filter" json:"filter"`
+	Projection string `yaml:"projection" json:"projection"`
+	// RecentBy samples the most recent documents by this field instead of
+	// random ones.
+	RecentBy string `yaml:"recentBy" json:"recentBy"`
+	// DateField, Since and Until limit the documents sampled to those whose
+	// DateField falls within the window. Since and Until are RFC3339 times
+	// or durations before now, such as 720h.
+	DateField string `yaml:"dateField" json:"dateField"`
+	Since     string `yaml:"since" json:"since"`
+	Until     string `yaml:"until" json:"until"`
+	// BatchSize is the number of documents fetched at a time during a full
+	// collection scan. 0 uses the server's default.
+	BatchSize int32 `yaml:"batchSize" json:"batchSize"`
+	// ReadPreference is the read preference mode, such as
+	// secondaryPreferred.
+	ReadPreference string `yaml:"readPreference" json:"readPreference"`
+	// TLSCAFile and TLSCertificateKeyFile enable TLS using the certificate
+	// authority and client certificate in the files.
+	TLSCAFile             string `yaml:"tlsCAFile" json:"tlsCAFile"`
+	TLSCertificateKeyFile string `yaml:"tlsCertificateKeyFile" json:"tlsCertificateKeyFile"`
+	// AuthMechanism is the authentication mechanism, such as SCRAM-SHA-256
+	// or MONGODB-X509.
+	AuthMechanism string `yaml:"authMechanism" json:"authMechanism"`
+	// AppName is the application name reported to the server.
+	AppName string `yaml:"appName" json:"appName"`
+	// ServerSelectionTimeout and OperationTimeout are durations, such as
+	// 30s, as taken by the mongodb command's flags of the same names.
+	ServerSelectionTimeout string `yaml:"serverSelectionTimeout" json:"serverSelectionTimeout"`
+	OperationTimeout       string `yaml:"operationTimeout" json:"operationTimeout"`
+}
+
+// Find looks for the configuration file in dir and then in each of its
+// parents, returning the path of the first one found.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range Filenames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found", strings.Join(Filenames, ", "))
+		}
+		dir = parent
+	}
+}
+
+// Load reads the configuration file, which is JSON when its name ends in
+// .json and YAML otherwise.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if filepath.Ext(path) == ".json" {
+		// unknown fields are rejected like yaml's, so typos don't go unnoticed.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		err = yaml.UnmarshalStrict(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if cfg.Dir, err = filepath.Abs(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	for i, job := range cfg.Jobs {
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job %d", i+1)
+		}
+		if job.Provider == "" {
+			return nil, fmt.Errorf("%s: %s has no provider", path, job.Name)
+		}
+		if job.Output != "" && job.OutputDir != "" {
+			return nil, fmt.Errorf("%s: %s has both an output and an output directory", path, job.Name)
+		}
+		if job.State != "" && job.SchemaOutput != "" {
+			return nil, fmt.Errorf("%s: %s has both a state and a schema output", path, job.Name)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Path resolves a path from the configuration file against its directory.
+func (c *Config) Path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(c.Dir, path)
+}
@@ -0,0 +1,94 @@
+// Package decompress transparently decompresses input based on its magic
+// bytes.
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// gzipMagic includes the deflate method, gzip's only one, as the first
+	// two bytes alone are also the length of a 35615-byte BSON document.
+	gzipMagic  = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// extensions are the file extensions of the compression formats.
+var extensions = []string{".gz", ".zst", ".bz2"}
+
+// NewReader returns a reader of the decompressed contents of r when it is
+// gzip, zstd or bzip2 compressed, or of r itself otherwise.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
+
+// Open opens the named file for reading, decompressing it when needed.
+func Open(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &file{ReadCloser: r, f: f}, nil
+}
+
+// file closes both the decompressed reader and the file under it.
+type file struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (f *file) Close() error {
+	err := f.ReadCloser.Close()
+	if ferr := f.f.Close(); err == nil {
+		err = ferr
+	}
+
+	return err
+}
+
+// TrimExt removes the extension of a compression format from the filename.
+func TrimExt(filename string) string {
+	for _, ext := range extensions {
+		if strings.HasSuffix(filename, ext) {
+			return strings.TrimSuffix(filename, ext)
+		}
+	}
+
+	return filename
+}
@@ -0,0 +1,136 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// helloBzip2 is "hello, world" compressed with bzip2, which the standard
+// library can only decompress.
+var helloBzip2 = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x42, 0xf7,
+	0xdd, 0x4a, 0x00, 0x00, 0x02, 0x11, 0x80, 0x40, 0x04, 0x06, 0x44, 0x90,
+	0x80, 0x20, 0x00, 0x31, 0x06, 0x4c, 0x41, 0x00, 0x7a, 0x25, 0x01, 0xc9,
+	0x6c, 0x31, 0xf8, 0xbb, 0x92, 0x29, 0xc2, 0x84, 0x82, 0x17, 0xbe, 0xea,
+	0x50,
+}
+
+func TestNewReader(t *testing.T) {
+	hello := []byte("hello, world")
+
+	testCases := []struct {
+		name  string
+		input []byte
+		want  []byte
+	}{
+		{
+			name:  "gzip",
+			input: gzipped(t, hello),
+			want:  hello,
+		},
+		{
+			name:  "zstd",
+			input: zstded(t, hello),
+			want:  hello,
+		},
+		{
+			name:  "bzip2",
+			input: helloBzip2,
+			want:  hello,
+		},
+		{
+			name:  "uncompressed",
+			input: hello,
+			want:  hello,
+		},
+		{
+			name:  "bson document with the length of the gzip magic",
+			input: []byte{0x1f, 0x8b, 0x00, 0x00, 0x03},
+			want:  []byte{0x1f, 0x8b, 0x00, 0x00, 0x03},
+		},
+		{
+			name:  "shorter than any magic",
+			input: []byte{0x1f},
+			want:  []byte{0x1f},
+		},
+		{
+			name:  "empty",
+			input: []byte{},
+			want:  []byte{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() {
+				_ = r.Close()
+			}()
+
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTrimExt(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "orders.bson.gz", want: "orders.bson"},
+		{filename: "orders.bson.zst", want: "orders.bson"},
+		{filename: "orders.json.bz2", want: "orders.json"},
+		{filename: "orders.bson", want: "orders.bson"},
+		{filename: "orders.gz.bson", want: "orders.gz.bson"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			if got := TrimExt(tc.filename); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+
+	return w.EncodeAll(data, nil)
+}
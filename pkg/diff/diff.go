@@ -0,0 +1,277 @@
+// Package diff compares the structs inferred at different times, such as
+// those of a previously generated file against the data as it is now, to
+// detect a schema drifting.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/generate"
+)
+
+// Field describes a field in a snapshot.
+type Field struct {
+	// Type is the Go type of the field, without the pointer making it
+	// nullable. Structs written inline are simply struct, as their fields
+	// have paths of their own.
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// Snapshot holds the fields of a set of structs keyed by struct path: the
+// name of the struct followed by the dotted keys of the field, as in
+// Order.items.price.
+type Snapshot map[string]Field
+
+// tagPriority are the struct tags giving the key of a field, before its name.
+var tagPriority = []string{"bson", "json"}
+
+// FromSource takes a snapshot of the structs declared in Go source. Fields
+// marked with the keep directive are left out, as they are written by hand
+// rather than inferred.
+func FromSource(src []byte) (Snapshot, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(Snapshot)
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				s.addFields(fset, ts.Name.Name, st)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s Snapshot) addFields(fset *token.FileSet, prefix string, st *ast.StructType) {
+	for _, f := range st.Fields.List {
+		if hasKeep(f.Doc) || hasKeep(f.Comment) {
+			continue
+		}
+
+		var names []string
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, typeString(fset, f.Type))
+		}
+
+		key := names[0]
+		if f.Tag != nil {
+			key = tagKey(f.Tag.Value, key)
+		}
+		if key == "-" {
+			continue
+		}
+
+		expr := f.Type
+		nullable := false
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+			nullable = true
+		}
+
+		path := prefix + "." + key
+		if inner, ok := expr.(*ast.StructType); ok {
+			s[path] = Field{Type: "struct", Nullable: nullable}
+			s.addFields(fset, path, inner)
+			continue
+		}
+
+		s[path] = Field{Type: typeString(fset, expr), Nullable: nullable}
+	}
+}
+
+func hasKeep(cg *ast.CommentGroup) bool {
+	return cg != nil && strings.Contains(cg.Text(), generate.KeepDirective)
+}
+
+// tagKey finds the key of a field in its struct tags, falling back to its
+// name.
+func tagKey(literal string, name string) string {
+	tag, err := strconv.Unquote(literal)
+	if err != nil {
+		return name
+	}
+
+	for _, t := range tagPriority {
+		if value, ok := reflect.StructTag(tag).Lookup(t); ok {
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value = value[:i]
+			}
+			if value != "" {
+				return value
+			}
+		}
+	}
+
+	return name
+}
+
+func typeString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// Load reads a snapshot from a Go file, the files generated into a
+// directory, or the JSON written by Save.
+func Load(path string) (Snapshot, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return loadDir(path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if filepath.Ext(path) == ".go" {
+		s, err = FromSource(data)
+	} else {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return s, nil
+}
+
+// loadDir reads the files listed in the directory's manifest, leaving out
+// those written by hand.
+func loadDir(dir string) (Snapshot, error) {
+	names, err := generate.ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: no files generated by typeprovider", dir)
+	}
+
+	s := make(Snapshot)
+	for _, name := range names {
+		fs, err := Load(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		for path, f := range fs {
+			s[path] = f
+		}
+	}
+
+	return s, nil
+}
+
+// Save writes the snapshot as JSON.
+func (s Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
+
+// ChangeKind is the kind of a change.
+type ChangeKind int
+
+// The kinds of changes.
+const (
+	Added ChangeKind = iota
+	Removed
+	TypeChanged
+	NullabilityChanged
+)
+
+// Change is a difference between two snapshots at a struct path. Old is nil
+// when the field was added and New is nil when it was removed.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  *Field
+	New  *Field
+}
+
+func (c *Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s %s", c.Path, fieldString(c.New))
+	case Removed:
+		return fmt.Sprintf("- %s %s", c.Path, fieldString(c.Old))
+	case TypeChanged:
+		return fmt.Sprintf("~ %s %s -> %s", c.Path, fieldString(c.Old), fieldString(c.New))
+	default:
+		return fmt.Sprintf("~ %s %s -> %s", c.Path, nullability(c.Old), nullability(c.New))
+	}
+}
+
+func fieldString(f *Field) string {
+	if f.Nullable {
+		return "*" + f.Type
+	}
+
+	return f.Type
+}
+
+func nullability(f *Field) string {
+	if f.Nullable {
+		return "nullable"
+	}
+
+	return "required"
+}
+
+// Compare finds the changes from the old snapshot to the new one, ordered by
+// path. A field whose type changed is not also reported for its nullability.
+func Compare(old Snapshot, new Snapshot) []*Change {
+	var changes []*Change
+	for path, o := range old {
+		o := o
+		n, ok := new[path]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Path: path, Kind: Removed, Old: &o})
+		case n.Type != o.Type:
+			changes = append(changes, &Change{Path: path, Kind: TypeChanged, Old: &o, New: &n})
+		case n.Nullable != o.Nullable:
+			changes = append(changes, &Change{Path: path, Kind: NullabilityChanged, Old: &o, New: &n})
+		}
+	}
+	for path, n := range new {
+		n := n
+		if _, ok := old[path]; !ok {
+			changes = append(changes, &Change{Path: path, Kind: Added, New: &n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
@@ -0,0 +1,81 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		name string
+		old  string
+		new  string
+		want []string
+	}{
+		{
+			name: "unchanged",
+			old:  "type Order struct {\n\tID int32 `bson:\"_id\"`\n}",
+			new:  "type Order struct {\n\tID int32 `bson:\"_id\"`\n}",
+		},
+		{
+			name: "added and removed",
+			old:  "type Order struct {\n\tA string `bson:\"a\"`\n}",
+			new:  "type Order struct {\n\tB *string `bson:\"b\"`\n}",
+			want: []string{"- Order.a string", "+ Order.b *string"},
+		},
+		{
+			name: "type changed",
+			old:  "type Order struct {\n\tA int32 `bson:\"a\"`\n}",
+			new:  "type Order struct {\n\tA *int64 `bson:\"a\"`\n}",
+			want: []string{"~ Order.a int32 -> *int64"},
+		},
+		{
+			name: "nullability changed",
+			old:  "type Order struct {\n\tA *int32 `json:\"a\"`\n}",
+			new:  "type Order struct {\n\tA int32 `json:\"a\"`\n}",
+			want: []string{"~ Order.a nullable -> required"},
+		},
+		{
+			name: "renamed field with the same key",
+			old:  "type Order struct {\n\tA int32 `bson:\"a\"`\n}",
+			new:  "type Order struct {\n\tAlpha int32 `bson:\"a,omitempty\"`\n}",
+		},
+		{
+			name: "inline structs",
+			old:  "type Order struct {\n\tItem struct {\n\t\tPrice float64 `bson:\"price\"`\n\t} `bson:\"item\"`\n}",
+			new:  "type Order struct {\n\tItem *struct {\n\t\tPrice string `bson:\"price\"`\n\t} `bson:\"item\"`\n}",
+			want: []string{"~ Order.item required -> nullable", "~ Order.item.price float64 -> string"},
+		},
+		{
+			name: "kept fields are left out",
+			old:  "type Order struct {\n\tA int32 `bson:\"a\"`\n\tNote string // typeprovider:keep\n}",
+			new:  "type Order struct {\n\tA int32 `bson:\"a\"`\n}",
+		},
+		{
+			name: "skipped fields are left out",
+			old:  "type Order struct {\n\tA int32 `bson:\"-\"`\n}",
+			new:  "type Order struct {\n}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			old, err := FromSource([]byte("package p\n\n" + tc.old))
+			if err != nil {
+				t.Fatal(err)
+			}
+			new, err := FromSource([]byte("package p\n\n" + tc.new))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, c := range Compare(old, new) {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package extjson reads MongoDB Extended JSON in any of the forms tools
+// produce: canonical and relaxed v2, the legacy forms of older mongoexport
+// versions, and the shell's constructor syntax such as ObjectId("...").
+package extjson
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+// Mode is the flavor of Extended JSON being read.
+type Mode string
+
+const (
+	// ModeAuto accepts every flavor, detecting each form as it is seen.
+	ModeAuto Mode = "auto"
+	// ModeCanonical reads canonical v2, where every number is wrapped.
+	ModeCanonical Mode = "canonical"
+	// ModeRelaxed reads relaxed v2, where plain integers are int32 when they
+	// fit, int64 otherwise, and other numbers are doubles.
+	ModeRelaxed Mode = "relaxed"
+	// ModeShell reads the shell's syntax and the legacy mongoexport forms,
+	// such as {"$date": 1000} and {"$binary": "...", "$type": "00"}.
+	ModeShell Mode = "shell"
+	// ModePlain reads ordinary JSON, where nothing has special meaning and
+	// integers too large for an int64 are kept as decimal128.
+	ModePlain Mode = "plain"
+)
+
+// ParseMode parses the name of a mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeAuto, ModeCanonical, ModeRelaxed, ModeShell, ModePlain:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown extended JSON mode %q", s)
+	}
+}
+
+// NewReader makes a Reader. The documents may be concatenated, one per line,
+// or elements of top-level arrays.
+func NewReader(r io.Reader, mode Mode) *Reader {
+	return &Reader{
+		r:    r,
+		mode: mode,
+	}
+}
+
+// Reader reads documents from Extended JSON.
+type Reader struct {
+	r    io.Reader
+	mode Mode
+	p    *parser
+}
+
+// ReadDocument reads the next document. It returns io.EOF when there are no
+// more.
+func (r *Reader) ReadDocument() (*bson.Document, error) {
+	if r.p == nil {
+		data, err := ioutil.ReadAll(r.r)
+		if err != nil {
+			return nil, err
+		}
+
+		r.p = newParser(data, r.mode)
+	}
+
+	v, err := r.p.next()
+	if err != nil {
+		return nil, err
+	}
+	if v.kind != objectKind {
+		return nil, r.p.errorf("expected a document")
+	}
+	if r.mode == ModePlain {
+		return v.document(), nil
+	}
+
+	var buf bytes.Buffer
+	v.writeTo(&buf)
+	return bson.ParseExtJSONObject(buf.String())
+}
+
+// ParseDocument parses a single document.
+func ParseDocument(s string, mode Mode) (*bson.Document, error) {
+	return NewReader(bytes.NewReader([]byte(s)), mode).ReadDocument()
+}
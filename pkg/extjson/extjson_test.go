@@ -0,0 +1,143 @@
+package extjson
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mode    Mode
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "canonical",
+			mode:  ModeCanonical,
+			input: `{"a":{"$numberInt":"1"},"b":{"$numberLong":"2"},"c":{"$numberDouble":"1.5"},"d":{"$date":{"$numberLong":"1000"}},"e":{"$oid":"5a934e000102030405000000"}}`,
+			want:  `{"a":{"$numberInt":"1"},"b":{"$numberLong":"2"},"c":{"$numberDouble":"1.5"},"d":{"$date":{"$numberLong":"1000"}},"e":{"$oid":"5a934e000102030405000000"}}`,
+		},
+		{
+			name:    "canonical rejects shell syntax",
+			mode:    ModeCanonical,
+			input:   `{_id: ObjectId("5a934e000102030405000000")}`,
+			wantErr: true,
+		},
+		{
+			name:  "relaxed numbers",
+			mode:  ModeRelaxed,
+			input: `{"a":1,"b":3000000000,"c":1.5}`,
+			want:  `{"a":{"$numberInt":"1"},"b":{"$numberLong":"3000000000"},"c":{"$numberDouble":"1.5"}}`,
+		},
+		{
+			name:  "relaxed date",
+			mode:  ModeRelaxed,
+			input: `{"d":{"$date":"1970-01-01T00:00:01Z"}}`,
+			want:  `{"d":{"$date":{"$numberLong":"1000"}}}`,
+		},
+		{
+			name:    "relaxed rejects legacy date",
+			mode:    ModeRelaxed,
+			input:   `{"d":{"$date":1000}}`,
+			wantErr: true,
+		},
+		{
+			name:  "shell constructors",
+			mode:  ModeShell,
+			input: `{_id: ObjectId("5a934e000102030405000000"), n: NumberLong(5), i: NumberInt(3), d: ISODate("2020-01-01T00:00:00Z"), 'q': 'x', r: /ab/i}`,
+			want:  `{"_id":{"$oid":"5a934e000102030405000000"},"n":{"$numberLong":"5"},"i":{"$numberInt":"3"},"d":{"$date":{"$numberLong":"1577836800000"}},"q":"x","r":{"$regularExpression":{"pattern":"ab","options":"i"}}}`,
+		},
+		{
+			name:  "shell legacy forms",
+			mode:  ModeShell,
+			input: `{"d":{"$date":1000},"b":{"$binary":"AQI=","$type":"00"}}`,
+			want:  `{"d":{"$date":{"$numberLong":"1000"}},"b":{"$binary":{"base64":"AQI=","subType":"00"}}}`,
+		},
+		{
+			name:  "shell special numbers",
+			mode:  ModeShell,
+			input: `{"n": -Infinity, "m": NaN}`,
+			want:  `{"n":{"$numberDouble":"-Infinity"},"m":{"$numberDouble":"NaN"}}`,
+		},
+		{
+			name:  "auto mixes forms",
+			mode:  ModeAuto,
+			input: `{"x": NumberDecimal("1.5"), "u": UUID("00112233-4455-6677-8899-aabbccddeeff"), "n": {"$numberInt": "2"}}`,
+			want:  `{"x":{"$numberDecimal":"1.5"},"u":{"$binary":{"base64":"ABEiM0RVZneImaq7zN3u/w==","subType":"04"}},"n":{"$numberInt":"2"}}`,
+		},
+		{
+			name:  "surrogate pair escape",
+			mode:  ModeAuto,
+			input: `{"s":"\ud83d\ude00 \u00e9"}`,
+			want:  `{"s":"😀 é"}`,
+		},
+		{
+			name:  "lone surrogate escape",
+			mode:  ModeAuto,
+			input: `{"s":"\ud83d"}`,
+			want:  `{"s":"` + "�" + `"}`,
+		},
+		{
+			name:  "plain",
+			mode:  ModePlain,
+			input: `{"a":1,"big":123456789012345678901234567890,"$date":5}`,
+			want:  `{"a":{"$numberInt":"1"},"big":{"$numberDecimal":"123456789012345678901234567890"},"$date":{"$numberInt":"5"}}`,
+		},
+		{
+			name:    "syntax error",
+			mode:    ModeAuto,
+			input:   `{"a":}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := ParseDocument(tc.input, tc.mode)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", doc.ToExtJSON(true))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := doc.ToExtJSON(true); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReaderTopLevelArrays(t *testing.T) {
+	r := NewReader(strings.NewReader("[{\"a\":1},{\"a\":2}]\n{\"a\":3}\n[]\n"), ModeRelaxed)
+
+	var got []string
+	for {
+		doc, err := r.ReadDocument()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, doc.ToExtJSON(true))
+	}
+
+	want := []string{`{"a":{"$numberInt":"1"}}`, `{"a":{"$numberInt":"2"}}`, `{"a":{"$numberInt":"3"}}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReaderRejectsNonDocuments(t *testing.T) {
+	r := NewReader(strings.NewReader(`[1, 2]`), ModeAuto)
+	if _, err := r.ReadDocument(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
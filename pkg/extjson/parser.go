@@ -0,0 +1,518 @@
+package extjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type kind int
+
+const (
+	objectKind kind = iota
+	arrayKind
+	stringKind
+	numberKind
+	literalKind
+)
+
+// value is a parsed JSON value. Objects keep their keys in order.
+type value struct {
+	kind   kind
+	keys   []string
+	values []*value
+	text   string
+}
+
+func newObject(keys []string, values ...*value) *value {
+	return &value{kind: objectKind, keys: keys, values: values}
+}
+
+func newString(s string) *value {
+	return &value{kind: stringKind, text: s}
+}
+
+func newNumber(s string) *value {
+	return &value{kind: numberKind, text: s}
+}
+
+func (v *value) lookup(key string) *value {
+	for i, k := range v.keys {
+		if k == key {
+			return v.values[i]
+		}
+	}
+
+	return nil
+}
+
+func (v *value) writeTo(buf *bytes.Buffer) {
+	switch v.kind {
+	case objectKind:
+		buf.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, k)
+			buf.WriteByte(':')
+			v.values[i].writeTo(buf)
+		}
+		buf.WriteByte('}')
+	case arrayKind:
+		buf.WriteByte('[')
+		for i, e := range v.values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			e.writeTo(buf)
+		}
+		buf.WriteByte(']')
+	case stringKind:
+		writeString(buf, v.text)
+	default:
+		buf.WriteString(v.text)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+func newParser(data []byte, mode Mode) *parser {
+	return &parser{
+		data: data,
+		mode: mode,
+	}
+}
+
+// parser reads a sequence of values, which may be wrapped in top-level
+// arrays.
+type parser struct {
+	data []byte
+	pos  int
+	mode Mode
+	// inArray is set within a top-level array, and started once its first
+	// element has been read.
+	inArray bool
+	started bool
+}
+
+func (p *parser) shell() bool {
+	return p.mode == ModeAuto || p.mode == ModeShell
+}
+
+func (p *parser) next() (*value, error) {
+	p.skipSpace()
+	if p.inArray && p.started {
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			p.inArray = false
+		default:
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+
+	for {
+		p.skipSpace()
+		if p.inArray || p.peek() != '[' {
+			break
+		}
+
+		// each top-level array holds documents, as when concatenating the
+		// output of several jsonArray exports.
+		p.pos++
+		p.inArray = true
+		p.started = false
+		p.skipSpace()
+		if p.peek() == ']' {
+			p.pos++
+			p.inArray = false
+		}
+	}
+	p.started = true
+
+	if p.pos >= len(p.data) {
+		if p.inArray {
+			return nil, p.errorf("unexpected end of input")
+		}
+		return nil, io.EOF
+	}
+	if p.peek() == ']' {
+		return nil, p.errorf("unexpected ']'")
+	}
+
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.mode == ModePlain {
+		return v, nil
+	}
+
+	return p.normalize(v)
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+
+	return p.data[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.errorf("expected '%c'", c)
+	}
+
+	p.pos++
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line, col := 1, 1
+	for _, c := range p.data[:p.pos] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+
+	return fmt.Errorf("extended JSON %d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseValue() (*value, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || (c == '\'' && p.shell()):
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return newString(s), nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c == '/' && p.shell():
+		return p.parseRegex()
+	case isIdentifierStart(c):
+		return p.parseIdentifier()
+	case c == 0:
+		return nil, p.errorf("unexpected end of input")
+	default:
+		return nil, p.errorf("unexpected '%c'", c)
+	}
+}
+
+func (p *parser) parseObject() (*value, error) {
+	p.pos++
+	v := &value{kind: objectKind}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return v, nil
+	}
+
+	for {
+		p.skipSpace()
+		var key string
+		var err error
+		if c := p.peek(); c == '"' || (c == '\'' && p.shell()) {
+			key, err = p.parseString()
+		} else if isIdentifierStart(c) && p.shell() {
+			// the shell leaves simple keys unquoted.
+			key = p.readIdentifier()
+		} else {
+			err = p.errorf("expected a key")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+
+		e, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		v.keys = append(v.keys, key)
+		v.values = append(v.values, e)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return v, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (p *parser) parseArray() (*value, error) {
+	p.pos++
+	v := &value{kind: arrayKind}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return v, nil
+	}
+
+	for {
+		e, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		v.values = append(v.values, e)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return v, nil
+		default:
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (p *parser) parseString() (string, error) {
+	quote := p.data[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.data[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '\\':
+			p.pos++
+			r, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		default:
+			r, size := utf8.DecodeRune(p.data[p.pos:])
+			sb.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+func (p *parser) parseEscape() (rune, error) {
+	c := p.peek()
+	p.pos++
+	switch c {
+	case '"', '\'', '\\', '/':
+		return rune(c), nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		r, err := p.parseHex4()
+		if err != nil {
+			return 0, err
+		}
+		if utf16.IsSurrogate(r) && bytes.HasPrefix(p.data[p.pos:], []byte(`\u`)) {
+			p.pos += 2
+			r2, err := p.parseHex4()
+			if err != nil {
+				return 0, err
+			}
+			r = utf16.DecodeRune(r, r2)
+		}
+		return r, nil
+	default:
+		return 0, p.errorf("invalid escape '\\%c'", c)
+	}
+}
+
+func (p *parser) parseHex4() (rune, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, p.errorf("invalid unicode escape")
+	}
+
+	n, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+
+	p.pos += 4
+	return rune(n), nil
+}
+
+func (p *parser) parseNumber() (*value, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+		if p.shell() && bytes.HasPrefix(p.data[p.pos:], []byte("Infinity")) {
+			p.pos += len("Infinity")
+			return newObject([]string{"$numberDouble"}, newString("-Infinity")), nil
+		}
+	}
+
+	for p.pos < len(p.data) && strings.IndexByte("0123456789.eE+-", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	text := string(p.data[start:p.pos])
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+
+	return newNumber(text), nil
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *parser) readIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentifierPart(p.data[p.pos]) {
+		p.pos++
+	}
+
+	return string(p.data[start:p.pos])
+}
+
+func (p *parser) parseIdentifier() (*value, error) {
+	start := p.pos
+	name := p.readIdentifier()
+	switch name {
+	case "true", "false", "null":
+		return &value{kind: literalKind, text: name}, nil
+	}
+
+	if !p.shell() {
+		p.pos = start
+		return nil, p.errorf("shell syntax %q is not allowed in %s mode", name, p.mode)
+	}
+
+	if name == "new" {
+		p.skipSpace()
+		name = p.readIdentifier()
+	}
+
+	v, err := p.parseShellValue(name)
+	if err != nil {
+		p.pos = start
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// parseArguments reads the parenthesized arguments of a shell constructor.
+// The parentheses are optional when there are no arguments.
+func (p *parser) parseArguments() ([]*value, error) {
+	p.skipSpace()
+	if p.peek() != '(' {
+		return nil, nil
+	}
+	p.pos++
+
+	var args []*value
+	p.skipSpace()
+	if p.peek() == ')' {
+		p.pos++
+		return nil, nil
+	}
+
+	for {
+		arg, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+func (p *parser) parseRegex() (*value, error) {
+	p.pos++
+
+	var pattern strings.Builder
+	for {
+		if p.pos >= len(p.data) || p.data[p.pos] == '\n' {
+			return nil, p.errorf("unterminated regular expression")
+		}
+
+		c := p.data[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		pattern.WriteByte(c)
+		if c == '\\' && p.pos < len(p.data) {
+			pattern.WriteByte(p.data[p.pos])
+			p.pos++
+		}
+	}
+
+	return regularExpression(pattern.String(), p.readIdentifier()), nil
+}
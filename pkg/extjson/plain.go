@@ -0,0 +1,66 @@
+package extjson
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/decimal"
+)
+
+// document builds a document from the object without interpreting any of it
+// as Extended JSON, for use with ordinary JSON.
+func (v *value) document() *bson.Document {
+	doc := bson.NewDocument()
+	for i, key := range v.keys {
+		doc.Append(bson.EC.FromValue(key, v.values[i].plainValue()))
+	}
+
+	return doc
+}
+
+func (v *value) plainValue() *bson.Value {
+	switch v.kind {
+	case objectKind:
+		return bson.VC.Document(v.document())
+	case arrayKind:
+		arr := bson.NewArray()
+		for _, e := range v.values {
+			arr.Append(e.plainValue())
+		}
+		return bson.VC.Array(arr)
+	case stringKind:
+		return bson.VC.String(v.text)
+	case numberKind:
+		return plainNumber(v.text)
+	default:
+		switch v.text {
+		case "true":
+			return bson.VC.Boolean(true)
+		case "false":
+			return bson.VC.Boolean(false)
+		default:
+			return bson.VC.Null()
+		}
+	}
+}
+
+// plainNumber reads a number from ordinary JSON. Integers are int32 when
+// they fit and int64 otherwise. Integers too large for an int64 are kept
+// exactly as a decimal128, and everything else is a double.
+func plainNumber(text string) *bson.Value {
+	if !strings.ContainsAny(text, ".eE") {
+		if n, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return bson.VC.Int32(int32(n))
+		}
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return bson.VC.Int64(n)
+		}
+		if d, err := decimal.ParseDecimal128(text); err == nil {
+			return bson.VC.Decimal128(d)
+		}
+	}
+
+	f, _ := strconv.ParseFloat(text, 64)
+	return bson.VC.Double(f)
+}
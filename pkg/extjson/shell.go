@@ -0,0 +1,303 @@
+package extjson
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wrapperKeys are the keys that begin the objects Extended JSON uses to
+// represent BSON types that JSON lacks.
+var wrapperKeys = map[string]struct{}{
+	"$binary":            {},
+	"$code":              {},
+	"$date":              {},
+	"$dbPointer":         {},
+	"$maxKey":            {},
+	"$minKey":            {},
+	"$numberDecimal":     {},
+	"$numberDouble":      {},
+	"$numberInt":         {},
+	"$numberLong":        {},
+	"$oid":               {},
+	"$regex":             {},
+	"$regularExpression": {},
+	"$symbol":            {},
+	"$timestamp":         {},
+	"$undefined":         {},
+	"$uuid":              {},
+}
+
+// normalize rewrites the value into canonical v2, which the driver parses
+// unambiguously.
+func (p *parser) normalize(v *value) (*value, error) {
+	switch v.kind {
+	case objectKind:
+		if len(v.keys) > 0 {
+			if _, ok := wrapperKeys[v.keys[0]]; ok {
+				if !p.shell() {
+					return v, nil
+				}
+				return p.normalizeLegacy(v)
+			}
+		}
+		fallthrough
+	case arrayKind:
+		for i, e := range v.values {
+			ne, err := p.normalize(e)
+			if err != nil {
+				return nil, err
+			}
+			v.values[i] = ne
+		}
+		return v, nil
+	case numberKind:
+		if p.mode == ModeCanonical {
+			return v, nil
+		}
+		return relaxedNumber(v.text), nil
+	default:
+		return v, nil
+	}
+}
+
+// relaxedNumber wraps a plain number the way relaxed v2 reads it: integers
+// are int32 when they fit and int64 otherwise, and everything else is a
+// double.
+func relaxedNumber(text string) *value {
+	if !strings.ContainsAny(text, ".eE") {
+		if _, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return newObject([]string{"$numberInt"}, newString(text))
+		}
+		if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return newObject([]string{"$numberLong"}, newString(text))
+		}
+	}
+
+	return newObject([]string{"$numberDouble"}, newString(text))
+}
+
+// normalizeLegacy rewrites the forms written by older versions of
+// mongoexport into their canonical v2 equivalents.
+func (p *parser) normalizeLegacy(v *value) (*value, error) {
+	key, inner := v.keys[0], v.values[0]
+	switch key {
+	case "$date":
+		switch inner.kind {
+		case numberKind:
+			ms, err := strconv.ParseFloat(inner.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid $date %s", inner.text)
+			}
+			return dateMillis(int64(ms)), nil
+		case stringKind:
+			if t, err := parseDate(inner.text); err == nil {
+				return dateMillis(toMillis(t)), nil
+			}
+		}
+	case "$binary":
+		if t := v.lookup("$type"); inner.kind == stringKind && t != nil && t.kind == stringKind {
+			return binary(t.text, inner.text), nil
+		}
+	case "$regex":
+		if o := v.lookup("$options"); inner.kind == stringKind && o != nil && o.kind == stringKind && len(v.keys) == 2 {
+			return regularExpression(inner.text, o.text), nil
+		}
+	case "$numberInt", "$numberLong", "$numberDouble", "$numberDecimal":
+		if inner.kind == numberKind {
+			return newObject([]string{key}, newString(inner.text)), nil
+		}
+	case "$uuid":
+		if inner.kind == stringKind {
+			return uuid(inner.text)
+		}
+	}
+
+	return v, nil
+}
+
+// parseShellValue builds the value for one of the shell's constructors or
+// special identifiers.
+func (p *parser) parseShellValue(name string) (*value, error) {
+	switch name {
+	case "undefined":
+		return newObject([]string{"$undefined"}, &value{kind: literalKind, text: "true"}), nil
+	case "NaN", "Infinity":
+		return newObject([]string{"$numberDouble"}, newString(name)), nil
+	}
+
+	args, err := p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "ObjectId", "ObjectID":
+		if s, ok := stringArg(args, 0); ok {
+			return newObject([]string{"$oid"}, newString(s)), nil
+		}
+	case "ISODate", "Date":
+		if len(args) == 1 && args[0].kind == numberKind {
+			ms, err := strconv.ParseFloat(args[0].text, 64)
+			if err == nil {
+				return dateMillis(int64(ms)), nil
+			}
+		}
+		if s, ok := stringArg(args, 0); ok {
+			t, err := parseDate(s)
+			if err != nil {
+				return nil, p.errorf("invalid date %q", s)
+			}
+			return dateMillis(toMillis(t)), nil
+		}
+	case "NumberInt", "Int32":
+		if s, ok := scalarArg(args, 0); ok {
+			return newObject([]string{"$numberInt"}, newString(s)), nil
+		}
+	case "NumberLong", "Long":
+		if s, ok := scalarArg(args, 0); ok {
+			return newObject([]string{"$numberLong"}, newString(s)), nil
+		}
+	case "NumberDecimal", "Decimal128":
+		if s, ok := scalarArg(args, 0); ok {
+			return newObject([]string{"$numberDecimal"}, newString(s)), nil
+		}
+	case "Double":
+		if s, ok := scalarArg(args, 0); ok {
+			return newObject([]string{"$numberDouble"}, newString(s)), nil
+		}
+	case "Timestamp":
+		if len(args) == 1 && args[0].kind == objectKind {
+			// newer shells print Timestamp({ t: 1, i: 2 }).
+			args = []*value{args[0].lookup("t"), args[0].lookup("i")}
+		}
+		if len(args) == 2 && isNumber(args[0]) && isNumber(args[1]) {
+			return newObject([]string{"$timestamp"}, newObject([]string{"t", "i"}, args[0], args[1])), nil
+		}
+	case "BinData":
+		sub, ok1 := scalarArg(args, 0)
+		data, ok2 := stringArg(args, 1)
+		if ok1 && ok2 {
+			n, err := strconv.Atoi(sub)
+			if err == nil {
+				return binary(fmt.Sprintf("%x", n), data), nil
+			}
+		}
+	case "HexData":
+		sub, ok1 := scalarArg(args, 0)
+		data, ok2 := stringArg(args, 1)
+		if ok1 && ok2 {
+			n, err1 := strconv.Atoi(sub)
+			b, err2 := hex.DecodeString(data)
+			if err1 == nil && err2 == nil {
+				return binary(fmt.Sprintf("%x", n), base64.StdEncoding.EncodeToString(b)), nil
+			}
+		}
+	case "UUID":
+		if s, ok := stringArg(args, 0); ok {
+			return uuid(s)
+		}
+	case "MinKey":
+		return newObject([]string{"$minKey"}, newNumber("1")), nil
+	case "MaxKey":
+		return newObject([]string{"$maxKey"}, newNumber("1")), nil
+	case "DBRef":
+		if len(args) >= 2 && args[0].kind == stringKind {
+			ref := newObject([]string{"$ref", "$id"}, args[0], args[1])
+			if len(args) == 3 {
+				ref.keys = append(ref.keys, "$db")
+				ref.values = append(ref.values, args[2])
+			}
+			return ref, nil
+		}
+	default:
+		return nil, p.errorf("unknown shell constructor %q", name)
+	}
+
+	return nil, p.errorf("invalid arguments to %s", name)
+}
+
+func stringArg(args []*value, i int) (string, bool) {
+	if i >= len(args) || args[i].kind != stringKind {
+		return "", false
+	}
+
+	return args[i].text, true
+}
+
+// scalarArg reads a string or number argument as text.
+func scalarArg(args []*value, i int) (string, bool) {
+	if i >= len(args) || (args[i].kind != stringKind && args[i].kind != numberKind) {
+		return "", false
+	}
+
+	return args[i].text, true
+}
+
+func isNumber(v *value) bool {
+	return v != nil && v.kind == numberKind
+}
+
+func dateMillis(ms int64) *value {
+	return newObject([]string{"$date"}, newObject([]string{"$numberLong"}, newString(strconv.FormatInt(ms, 10))))
+}
+
+func binary(subType string, data string) *value {
+	if len(subType) == 1 {
+		subType = "0" + subType
+	}
+
+	return newObject([]string{"$binary"}, newObject(
+		[]string{"base64", "subType"},
+		newString(data),
+		newString(subType),
+	))
+}
+
+func regularExpression(pattern string, options string) *value {
+	return newObject([]string{"$regularExpression"}, newObject(
+		[]string{"pattern", "options"},
+		newString(pattern),
+		newString(options),
+	))
+}
+
+// uuid makes a binary value of subtype 4 from the text form of a UUID.
+func uuid(s string) (*value, error) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("invalid UUID %q", s)
+	}
+
+	return binary("04", base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// dateLayouts are the layouts accepted for dates, most specific first.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// parseDate parses the dates the shell and mongoexport write. Dates without a
+// zone are UTC.
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+func toMillis(t time.Time) int64 {
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
@@ -0,0 +1,234 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// sharedFilename is the file holding the shared structs used by more than one
+// of the structs provided.
+const sharedFilename = "shared.go"
+
+// manifestFilename is the file listing the files written to a directory, so
+// that those no longer written can be removed without touching the others.
+const manifestFilename = ".typeprovider"
+
+// GenerateDir uses the struct provider to generate code into a file for each
+// of the structs provided, named after it, such as orders.go for Order. The
+// structs it names go along with it, except those shared with others, which
+// go in shared.go. Files written by an earlier run which are no longer
+// written are removed, unless merging and they hold code marked with the keep
+// directive, which is reported as an error. Unless merging, files which
+// weren't written by an earlier run are never replaced.
+func GenerateDir(ctx context.Context, p StructProvider, dir string, opts Options) error {
+	if opts.Format == FormatJSON {
+		return fmt.Errorf("a directory requires the %s format", FormatGo)
+	}
+
+	structs, err := p.ProvideStructs(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	owned, err := ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	files := splitFiles(structs, opts)
+	if !opts.Merge {
+		if err := checkUnowned(dir, files, owned); err != nil {
+			return err
+		}
+	}
+
+	written := make(map[string]struct{})
+	for _, f := range files {
+		out, err := render(f.structs, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.name, err)
+		}
+
+		if err := writeFile(filepath.Join(dir, f.name), out, opts); err != nil {
+			return err
+		}
+		written[f.name] = struct{}{}
+	}
+
+	var kept []string
+	for _, name := range owned {
+		if _, ok := written[name]; ok {
+			continue
+		}
+
+		filename := filepath.Join(dir, name)
+		if opts.Merge {
+			// code kept by hand would be lost with the file, so it stays
+			// until the code is moved.
+			data, err := ioutil.ReadFile(filename)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if bytes.Contains(data, []byte(KeepDirective)) {
+				kept = append(kept, name)
+				written[name] = struct{}{}
+				continue
+			}
+		}
+
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := writeManifest(dir, written); err != nil {
+		return err
+	}
+	if len(kept) > 0 {
+		return fmt.Errorf("%s: no longer generated, but not removed as it holds code marked %s", strings.Join(kept, ", "), KeepDirective)
+	}
+
+	return nil
+}
+
+// checkUnowned fails when one of the files would replace a file of the
+// directory that wasn't written by an earlier run, such as one written by
+// hand.
+func checkUnowned(dir string, files []*outputFile, owned []string) error {
+	isOwned := make(map[string]struct{}, len(owned))
+	for _, name := range owned {
+		isOwned[name] = struct{}{}
+	}
+
+	var unowned []string
+	for _, f := range files {
+		if _, ok := isOwned[f.name]; ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, f.name)); err == nil {
+			unowned = append(unowned, f.name)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(unowned) > 0 {
+		return fmt.Errorf("%s: already exists but wasn't generated; remove it or merge into it", strings.Join(unowned, ", "))
+	}
+
+	return nil
+}
+
+// outputFile is a file of a directory along with the structs it holds.
+type outputFile struct {
+	name    string
+	structs []*structbuilder.Struct
+}
+
+// splitFiles assigns each struct to a file, in the order they are provided.
+func splitFiles(structs []*structbuilder.Struct, opts Options) []*outputFile {
+	groups := make([][]*structbuilder.Struct, len(structs))
+	users := make(map[string]map[int]struct{})
+	for i, s := range structs {
+		groups[i] = unembed(s, opts)
+		for _, child := range groups[i] {
+			if !child.Shared {
+				continue
+			}
+			if users[child.Name] == nil {
+				users[child.Name] = make(map[int]struct{})
+			}
+			users[child.Name][i] = struct{}{}
+		}
+	}
+
+	var files []*outputFile
+	byName := make(map[string]*outputFile)
+	file := func(name string) *outputFile {
+		if f, ok := byName[name]; ok {
+			return f
+		}
+		f := &outputFile{name: name}
+		byName[name] = f
+		files = append(files, f)
+		return f
+	}
+
+	placed := make(map[string]struct{})
+	for i, group := range groups {
+		f := file(naming.File(structs[i].Name) + ".go")
+		for _, s := range group {
+			if s.Shared {
+				if _, ok := placed[s.Name]; ok {
+					continue
+				}
+				placed[s.Name] = struct{}{}
+
+				if len(users[s.Name]) > 1 {
+					shared := file(sharedFilename)
+					shared.structs = append(shared.structs, s)
+					continue
+				}
+			}
+
+			f.structs = append(f.structs, s)
+		}
+	}
+
+	return files
+}
+
+// ReadManifest reads the names of the files written to the directory by the
+// last run, which are none when nothing was generated into it.
+func ReadManifest(dir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		// only plain names are trusted, so an edited manifest can't remove
+		// files elsewhere.
+		if name == "" || strings.HasPrefix(name, "#") || name != filepath.Base(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, scanner.Err()
+}
+
+func writeManifest(dir string, written map[string]struct{}) error {
+	names := make([]string, 0, len(written))
+	for name := range written {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("# files generated by typeprovider, removed when no longer generated\n")
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, manifestFilename), buf.Bytes(), 0666)
+}
@@ -0,0 +1,171 @@
+package generate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+func TestGenerateDir(t *testing.T) {
+	order := &structbuilder.Struct{Name: "Order"}
+	user := &structbuilder.Struct{Name: "User"}
+
+	testCases := []struct {
+		name      string
+		existing  map[string]string
+		structs   []*structbuilder.Struct
+		merge     bool
+		wantFiles []string
+		wantErr   string
+	}{
+		{
+			name:      "empty directory",
+			structs:   []*structbuilder.Struct{order, user},
+			wantFiles: []string{".typeprovider", "orders.go", "users.go"},
+		},
+		{
+			name: "files no longer generated are removed",
+			existing: map[string]string{
+				".typeprovider": "orders.go\nusers.go\n",
+				"orders.go":     "package p\n",
+				"users.go":      "package p\n",
+				"helpers.go":    "package p\n",
+			},
+			structs:   []*structbuilder.Struct{order},
+			wantFiles: []string{".typeprovider", "helpers.go", "orders.go"},
+		},
+		{
+			name: "files no longer generated with kept code stay when merging",
+			existing: map[string]string{
+				".typeprovider": "orders.go\nusers.go\n",
+				"orders.go":     "package p\n",
+				"users.go":      "package p\n\n// typeprovider:keep\ntype Role int\n",
+			},
+			structs:   []*structbuilder.Struct{order},
+			merge:     true,
+			wantFiles: []string{".typeprovider", "orders.go", "users.go"},
+			wantErr:   "users.go: no longer generated, but not removed as it holds code marked typeprovider:keep",
+		},
+		{
+			name: "hand-written files aren't replaced",
+			existing: map[string]string{
+				"users.go": "package p\n\nfunc Hand() {}\n",
+			},
+			structs:   []*structbuilder.Struct{order, user},
+			wantFiles: []string{"users.go"},
+			wantErr:   "users.go: already exists but wasn't generated; remove it or merge into it",
+		},
+		{
+			name: "hand-written files are merged into",
+			existing: map[string]string{
+				"users.go": "package p\n\nfunc Hand() {}\n",
+			},
+			structs:   []*structbuilder.Struct{user},
+			merge:     true,
+			wantFiles: []string{".typeprovider", "users.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "generate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = os.RemoveAll(dir)
+			}()
+			for name, content := range tc.existing {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = GenerateDir(context.Background(), staticProvider(tc.structs), dir, Options{Package: "p", Merge: tc.merge})
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q but got %v", tc.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := dirFiles(t, dir); !reflect.DeepEqual(got, tc.wantFiles) {
+				t.Errorf("expected %q but got %q", tc.wantFiles, got)
+			}
+			for name, content := range tc.existing {
+				if !strings.Contains(content, "func Hand") {
+					continue
+				}
+				data, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), "func Hand() {}") {
+					t.Errorf("expected %s to keep the hand-written code but got\n%s", name, data)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitFiles(t *testing.T) {
+	address := &structbuilder.Struct{Name: "Address", Shared: true}
+	item := &structbuilder.Struct{Name: "Item", Shared: true}
+	withFields := func(name string, children ...*structbuilder.Struct) *structbuilder.Struct {
+		s := &structbuilder.Struct{Name: name}
+		for _, child := range children {
+			s.Fields = append(s.Fields, &structbuilder.Field{
+				Name: child.Name,
+				Type: &structbuilder.FieldType{Name: child.Name, EmbeddedStruct: child},
+			})
+		}
+		return s
+	}
+
+	got := make(map[string][]string)
+	for _, f := range splitFiles([]*structbuilder.Struct{
+		withFields("Order", address, item),
+		withFields("User", address),
+		withFields("UserWindow"),
+	}, Options{}) {
+		for _, s := range f.structs {
+			got[f.name] = append(got[f.name], s.Name)
+		}
+		sort.Strings(got[f.name])
+	}
+
+	want := map[string][]string{
+		"orders.go":           {"Item", "Order"},
+		"users.go":            {"User"},
+		"shared.go":           {"Address"},
+		"user_windows_gen.go": {"UserWindow"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+// dirFiles lists the names of the files in the directory.
+func dirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	return names
+}
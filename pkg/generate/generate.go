@@ -3,10 +3,11 @@ package generate
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"go/format"
 	"io/ioutil"
-	"sort"
+	"os"
 	"strings"
 	"text/template"
 
@@ -19,75 +20,169 @@ type StructProvider interface {
 	ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error)
 }
 
-// Generate uses the struct provider to generate and write code to the provided
-// filename.
-func Generate(ctx context.Context, p StructProvider, filename string, pkg string, embedStructs bool) error {
-	structs, err := p.ProvideStructs(ctx)
+// Generate uses the struct provider to generate code and write it to the
+// writer of the options.
+func Generate(ctx context.Context, p StructProvider, opts Options) error {
+	out, err := Render(ctx, p, opts)
+	if err != nil {
+		return err
+	}
+
+	w := opts.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// GenerateFile uses the struct provider to generate code and write it to the
+// provided filename.
+func GenerateFile(ctx context.Context, p StructProvider, filename string, opts Options) error {
+	out, err := Render(ctx, p, opts)
 	if err != nil {
 		return err
 	}
 
-	if !embedStructs {
-		var results []*structbuilder.Struct
-		for _, s := range structs {
-			results = append(results, s.UnembedStructs()...)
+	return writeFile(filename, out, opts)
+}
+
+// writeFile writes the generated code to the file, merging it with the code
+// already there when the options say so.
+func writeFile(filename string, out []byte, opts Options) error {
+	if opts.Merge {
+		if opts.Format != "" && opts.Format != FormatGo {
+			return fmt.Errorf("merging requires the %s format", FormatGo)
+		}
+
+		existing, err := ioutil.ReadFile(filename)
+		switch {
+		case err == nil:
+			out, err = mergeSource(existing, out)
+			if err != nil {
+				return fmt.Errorf("%s: %v", filename, err)
+			}
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(filename, out, 0666)
+}
+
+// Render uses the struct provider to generate code, returning it.
+func Render(ctx context.Context, p StructProvider, opts Options) ([]byte, error) {
+	structs, err := p.ProvideStructs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*structbuilder.Struct
+	for _, s := range structs {
+		results = append(results, unembed(s, opts)...)
+	}
+
+	return render(uniqueStructs(results), opts)
+}
+
+// unembed returns the struct and those of its children which are given
+// names, with the options applied.
+func unembed(s *structbuilder.Struct, opts Options) []*structbuilder.Struct {
+	var results []*structbuilder.Struct
+	if opts.EmbedStructs {
+		results = s.UnembedRequiredStructs()
+	} else {
+		results = s.UnembedStructs()
+	}
+
+	for _, s := range results {
+		if opts.FieldOrder == FieldOrderName {
+			sortFields(s)
+		}
+		if opts.OmitEmpty {
+			omitEmpty(s)
 		}
+	}
 
-		structs = results
+	return results
+}
+
+// render generates the code of a file holding the structs.
+func render(structs []*structbuilder.Struct, opts Options) ([]byte, error) {
+	if opts.Format == FormatJSON {
+		out, err := json.MarshalIndent(structs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
 	}
 
-	importPaths := uniqueImportPaths(structs)
+	header := opts.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+
+	imps := resolveImports(structs)
+	t, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{"typeName": imps.typeName})
 
 	data := struct {
-		Structs     []*structbuilder.Struct
-		Package     string
-		ImportPaths []string
+		Header  string
+		Structs []*structbuilder.Struct
+		Package string
+		Imports [][]importSpec
 	}{
+		header,
 		structs,
-		pkg,
-		importPaths,
+		opts.Package,
+		imps.groups,
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, &data); err != nil {
-		return err
-	}
-
-	//formatted := buf.Bytes()
-	formatted, err := format.Source(buf.Bytes())
-	if err != nil {
-		return err
+	if err := t.Execute(&buf, &data); err != nil {
+		return nil, err
 	}
 
-	if filename != "" {
-		return ioutil.WriteFile(filename, formatted, 0666)
+	if opts.Format == FormatGoUnformatted {
+		return buf.Bytes(), nil
 	}
 
-	fmt.Println(string(formatted))
-	return nil
+	return format.Source(buf.Bytes())
 }
 
-func uniqueImportPaths(structs []*structbuilder.Struct) []string {
+// uniqueStructs removes the repeated copies of shared structs.
+func uniqueStructs(structs []*structbuilder.Struct) []*structbuilder.Struct {
 	set := make(map[string]struct{})
-	var results []string
+	var results []*structbuilder.Struct
 	for _, s := range structs {
-		for _, f := range s.Fields {
-			if f.Type.ImportPath != "" {
-				if _, ok := set[f.Type.ImportPath]; !ok {
-					set[f.Type.ImportPath] = struct{}{}
-					results = append(results, f.Type.ImportPath)
-				}
+		if s.Shared {
+			if _, ok := set[s.Name]; ok {
+				continue
 			}
+			set[s.Name] = struct{}{}
 		}
+		results = append(results, s)
 	}
 
-	sort.Strings(results)
 	return results
 }
 
 var tmpl = template.Must(template.New("file").Funcs(template.FuncMap{
-	"brackets": func(count int) string {
-		return strings.Repeat("[]", count)
+	"brackets": func(ft *structbuilder.FieldType) string {
+		var b strings.Builder
+		for i := 0; i < ft.ArrayCount; i++ {
+			if i < len(ft.ArrayLengths) && ft.ArrayLengths[i] > 0 {
+				fmt.Fprintf(&b, "[%d]", ft.ArrayLengths[i])
+			} else {
+				b.WriteString("[]")
+			}
+		}
+
+		return b.String()
 	},
 	"canBeNull": func(canBeNull bool) string {
 		if canBeNull {
@@ -96,6 +191,11 @@ var tmpl = template.Must(template.New("file").Funcs(template.FuncMap{
 
 		return ""
 	},
+	// typeName is replaced for each file by the one of its imports.
+	"typeName": func(ft *structbuilder.FieldType) string {
+		return ft.Name
+	},
+	"indexOptions": indexOptions,
 	"quotedTags": func(tags []string) string {
 		if len(tags) > 0 {
 			return "`" + strings.Join(tags, " ") + "`"
@@ -103,25 +203,123 @@ var tmpl = template.Must(template.New("file").Funcs(template.FuncMap{
 
 		return ""
 	},
-}).Parse(`/* CODE GENERATED AUTOMATICALLY WITH github.com/craiggwilson/go-typeproviders */
+}).Parse(`{{.Header}}
+{{define "fieldType" -}}
+{{brackets . }} {{if .MapValue}} map[string]{{template "fieldType" .MapValue}} {{else}} {{canBeNull .CanBeNull }} {{if .EmbeddedStruct }}{{template "embeddedStruct" .EmbeddedStruct }} {{else}} {{typeName .}} {{end}} {{end}}
+{{- end}}
+
 {{define "embeddedStruct" -}}
 struct {
 	{{range .Fields}}
-	{{.Name}} {{brackets .Type.ArrayCount }} {{canBeNull .Type.CanBeNull }} {{if .Type.EmbeddedStruct }}{{template "embeddedStruct" .Type.EmbeddedStruct }} {{else}} {{.Type.Name}} {{end}} {{quotedTags .Tags }}
+	{{.Name}} {{template "fieldType" .Type }} {{quotedTags .Tags }}{{if .Type.Comment}} // {{.Type.Comment}}{{end}}
 	{{- end}}
 }
 {{- end}}
 
+{{define "tupleMethods" -}}
+{{- if not .Plain}}
+// UnmarshalBSONValue implements the bsoncodec.ValueUnmarshaler interface.
+func (t *{{.Name}}) UnmarshalBSONValue(bt bson.Type, data []byte) error {
+	if bt != bson.TypeArray {
+		return fmt.Errorf("cannot unmarshal %v into {{.Name}}", bt)
+	}
+
+	type tuple {{.Name}}
+	return bsoncodec.Unmarshal(data, (*tuple)(t))
+}
+{{end}}
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (t *{{.Name}}) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &[]interface{}{ {{- range .Fields}}&t.{{.Name}}, {{end -}} })
+}
+{{if not .Plain}}
+// MarshalBSONValue implements the bsoncodec.ValueMarshaler interface.
+func (t *{{.Name}}) MarshalBSONValue() (bson.Type, []byte, error) {
+	// an array is encoded as a document keyed by the positions.
+	type tuple {{.Name}}
+	data, err := bsoncodec.Marshal((*tuple)(t))
+	return bson.TypeArray, data, err
+}
+{{end}}
+// MarshalJSON implements the json.Marshaler interface.
+func (t *{{.Name}}) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{ {{- range .Fields}}t.{{.Name}}, {{end -}} })
+}
+{{end}}
+
+{{define "decodeFunc" -}}
+// Decode{{.Name}} decodes the document into the variant matching its {{.Discriminator}}.
+func Decode{{.Name}}(data []byte) (interface{}, error) {
+	var v interface{} = &{{.Name}}{}
+	if e, err := bson.Reader(data).Lookup({{printf "%q" .Discriminator}}); err == nil {
+		value, _ := e.Value().StringValueOK()
+		switch value {
+		{{- range .Variants}}
+		case {{printf "%q" .Value}}:
+			v = &{{.Struct.Name}}{}
+		{{- end}}
+		}
+	}
+
+	return v, bsoncodec.Unmarshal(data, v)
+}
+{{end}}
+
+{{define "indexesMethod" -}}
+// Indexes returns the indexes deployed on the collection.
+func ({{.Name}}) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{{- range .Indexes}}
+		{
+			Keys: bson.NewDocument(
+				{{- range .Keys}}
+				{{if .Kind}}bson.EC.String({{printf "%q" .Field}}, {{printf "%q" .Kind}}){{else}}bson.EC.Int32({{printf "%q" .Field}}, {{.Direction}}){{end}},
+				{{- end}}
+			),
+			Options: bson.NewDocument(
+				bson.EC.String("name", {{printf "%q" .Name}}),
+				{{- if .Unique}}
+				bson.EC.Boolean("unique", true),
+				{{- end}}
+				{{- if .Sparse}}
+				bson.EC.Boolean("sparse", true),
+				{{- end}}
+				{{- if .TTL}}
+				bson.EC.Int32("expireAfterSeconds", {{.ExpireAfterSeconds}}),
+				{{- end}}
+				{{- range indexOptions .Options}}
+				{{.}},
+				{{- end}}
+			),
+		},
+		{{- end}}
+	}
+}
+{{end}}
+
 {{define "struct" -}}
 type {{ .Name }} {{template "embeddedStruct" .}}
+{{if .Tuple}}
+{{template "tupleMethods" .}}
+{{- end}}
+{{if .Variants}}
+{{template "decodeFunc" .}}
+{{- end}}
+{{if .Indexes}}
+{{template "indexesMethod" .}}
+{{- end}}
 {{end}}
 
 package {{.Package}}
 
-{{if (len .ImportPaths) eq 0}}
+{{with .Imports}}
 import (
-	{{range .ImportPaths}}
-		"{{.}}"
+	{{- range $i, $group := .}}
+	{{if $i}}
+	{{end}}
+	{{- range $group}}
+	{{with .Name}}{{.}} {{end}}"{{.Path}}"
+	{{- end}}
 	{{- end}}
 )
 {{end}}
@@ -0,0 +1,245 @@
+package generate
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// tupleImportPaths are the imports needed by the methods of tuple structs.
+var tupleImportPaths = []string{
+	"encoding/json",
+	"fmt",
+	"github.com/mongodb/mongo-go-driver/bson",
+	"github.com/mongodb/mongo-go-driver/bson/bsoncodec",
+}
+
+// plainTupleImportPaths are the imports needed by the methods of tuple
+// structs built for ordinary JSON.
+var plainTupleImportPaths = []string{
+	"encoding/json",
+}
+
+// variantImportPaths are the imports needed by the decode functions of
+// structs with variants.
+var variantImportPaths = []string{
+	"github.com/mongodb/mongo-go-driver/bson",
+	"github.com/mongodb/mongo-go-driver/bson/bsoncodec",
+}
+
+// indexImportPaths are the imports needed by the Indexes methods of structs
+// with indexes.
+var indexImportPaths = []string{
+	"github.com/mongodb/mongo-go-driver/bson",
+	"github.com/mongodb/mongo-go-driver/mongo",
+}
+
+// importSpec is an import of a generated file. Name is only set when the
+// package is imported under a name other than its own.
+type importSpec struct {
+	Name string
+	Path string
+}
+
+// rename replaces the package qualifier of a type name.
+type rename struct {
+	from *regexp.Regexp
+	to   string
+}
+
+// imports are the imports of a generated file.
+type imports struct {
+	// groups holds the standard library imports, then the others, each
+	// sorted by path.
+	groups [][]importSpec
+	// renames holds, by import path, the packages imported under an alias
+	// because their name is taken by another.
+	renames map[string]*rename
+}
+
+// typeName returns the name of the field type as written in the file.
+func (imps *imports) typeName(ft *structbuilder.FieldType) string {
+	if r, ok := imps.renames[ft.ImportPath]; ok {
+		return r.from.ReplaceAllString(ft.Name, r.to+".")
+	}
+
+	return ft.Name
+}
+
+// resolveImports finds the imports needed by the structs, including those of
+// the types of the structs embedded in them. The packages used by the
+// generated methods keep their names, and a field type whose package name is
+// taken by another is given an alias.
+func resolveImports(structs []*structbuilder.Struct) *imports {
+	names := make(map[string]string)
+	taken := make(map[string]string)
+	for _, path := range uniqueImportPaths(structs) {
+		name := packageName(path)
+		names[path] = name
+		taken[name] = path
+	}
+
+	qualifiers := make(map[string]string)
+	var paths []string
+	walkFieldTypes(structs, func(ft *structbuilder.FieldType) {
+		if ft.ImportPath == "" {
+			return
+		}
+		if _, ok := qualifiers[ft.ImportPath]; ok {
+			return
+		}
+		q := qualifier(ft.Name)
+		if q == "" {
+			// the name doesn't use the package, so importing it would
+			// leave it unused.
+			return
+		}
+		qualifiers[ft.ImportPath] = q
+		paths = append(paths, ft.ImportPath)
+	})
+	sort.Strings(paths)
+
+	result := &imports{renames: make(map[string]*rename)}
+	for _, path := range paths {
+		q := qualifiers[path]
+		name, ok := names[path]
+		if !ok {
+			name = q
+			for i := 2; taken[name] != "" && taken[name] != path; i++ {
+				name = q + strconv.Itoa(i)
+			}
+			names[path] = name
+			taken[name] = path
+		}
+		if name != q {
+			result.renames[path] = &rename{
+				from: regexp.MustCompile(`\b` + regexp.QuoteMeta(q) + `\.`),
+				to:   name,
+			}
+		}
+	}
+
+	var std, others []importSpec
+	for path, name := range names {
+		spec := importSpec{Path: path}
+		if name != packageName(path) {
+			spec.Name = name
+		}
+		if isStandard(path) {
+			std = append(std, spec)
+		} else {
+			others = append(others, spec)
+		}
+	}
+	for _, group := range [][]importSpec{std, others} {
+		if len(group) == 0 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].Path < group[j].Path })
+		result.groups = append(result.groups, group)
+	}
+
+	return result
+}
+
+// uniqueImportPaths returns the imports needed by the methods generated for
+// the structs.
+func uniqueImportPaths(structs []*structbuilder.Struct) []string {
+	set := make(map[string]struct{})
+	var results []string
+	add := func(importPaths []string) {
+		for _, importPath := range importPaths {
+			if _, ok := set[importPath]; !ok {
+				set[importPath] = struct{}{}
+				results = append(results, importPath)
+			}
+		}
+	}
+	for _, s := range structs {
+		if s.Tuple && s.Plain {
+			add(plainTupleImportPaths)
+		} else if s.Tuple {
+			add(tupleImportPaths)
+		}
+		if len(s.Variants) > 0 {
+			add(variantImportPaths)
+		}
+		if len(s.Indexes) > 0 {
+			add(indexImportPaths)
+		}
+	}
+
+	sort.Strings(results)
+	return results
+}
+
+// walkFieldTypes calls fn with each field type whose name is written in the
+// file, following maps and the structs embedded in fields.
+func walkFieldTypes(structs []*structbuilder.Struct, fn func(*structbuilder.FieldType)) {
+	var walkType func(ft *structbuilder.FieldType)
+	walkStruct := func(s *structbuilder.Struct) {
+		for _, f := range s.Fields {
+			walkType(f.Type)
+		}
+	}
+	walkType = func(ft *structbuilder.FieldType) {
+		switch {
+		case ft.MapValue != nil:
+			walkType(ft.MapValue)
+		case ft.EmbeddedStruct != nil:
+			walkStruct(ft.EmbeddedStruct)
+		default:
+			fn(ft)
+		}
+	}
+
+	for _, s := range structs {
+		walkStruct(s)
+	}
+}
+
+var qualifierRegex = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+// qualifier returns the package qualifier of a type name, such as time for
+// time.Time.
+func qualifier(typeName string) string {
+	if m := qualifierRegex.FindStringSubmatch(typeName); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+var majorVersionRegex = regexp.MustCompile(`^v[0-9]+$`)
+
+// packageName guesses the name of the package at the import path the way
+// goimports does: the last element, skipping a major version and dropping
+// the go- prefix, -go suffix and .vN suffix of gopkg.in.
+func packageName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if majorVersionRegex.MatchString(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.LastIndex(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// isStandard reports whether the import path is of the standard library,
+// whose first element has no dot.
+func isStandard(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
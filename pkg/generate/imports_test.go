@@ -0,0 +1,162 @@
+package generate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+func TestResolveImports(t *testing.T) {
+	field := func(name string, importPath string) *structbuilder.Field {
+		return &structbuilder.Field{
+			Name: "F",
+			Type: &structbuilder.FieldType{Name: name, ImportPath: importPath},
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		structs    []*structbuilder.Struct
+		want       [][]importSpec
+		typeFields []*structbuilder.FieldType
+		wantTypes  []string
+	}{
+		{
+			name: "no imports",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Fields: []*structbuilder.Field{field("string", "")}},
+			},
+		},
+		{
+			name: "standard library first",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Fields: []*structbuilder.Field{
+					field("decimal.Decimal", "github.com/shopspring/decimal"),
+					field("time.Time", "time"),
+					field("*time.Time", "time"),
+				}},
+			},
+			want: [][]importSpec{
+				{{Path: "time"}},
+				{{Path: "github.com/shopspring/decimal"}},
+			},
+		},
+		{
+			name: "unqualified types are not imported",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Fields: []*structbuilder.Field{field("Status", "github.com/acme/orders")}},
+			},
+		},
+		{
+			name: "types of maps and embedded structs",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Fields: []*structbuilder.Field{
+					{Name: "Totals", Type: &structbuilder.FieldType{MapValue: &structbuilder.FieldType{Name: "decimal.Decimal", ImportPath: "github.com/shopspring/decimal"}}},
+					{Name: "Item", Type: &structbuilder.FieldType{Name: "OrderItem", EmbeddedStruct: &structbuilder.Struct{
+						Name:   "OrderItem",
+						Fields: []*structbuilder.Field{field("uuid.UUID", "github.com/google/uuid")},
+					}}},
+				}},
+			},
+			want: [][]importSpec{
+				{{Path: "github.com/google/uuid"}, {Path: "github.com/shopspring/decimal"}},
+			},
+		},
+		{
+			name: "versioned paths",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Fields: []*structbuilder.Field{
+					field("yaml.MapSlice", "gopkg.in/yaml.v2"),
+					field("redis.Z", "github.com/go-redis/redis/v8"),
+				}},
+			},
+			want: [][]importSpec{
+				{{Path: "github.com/go-redis/redis/v8"}, {Path: "gopkg.in/yaml.v2"}},
+			},
+		},
+		{
+			name: "package names taken by the generated methods",
+			structs: []*structbuilder.Struct{
+				{Name: "Order", Indexes: []*structbuilder.Index{{Name: "a"}}, Fields: []*structbuilder.Field{
+					field("bson.M", "gopkg.in/mgo.v2/bson"),
+					field("[]bson.ObjectId", "gopkg.in/mgo.v2/bson"),
+				}},
+			},
+			want: [][]importSpec{
+				{
+					{Path: "github.com/mongodb/mongo-go-driver/bson"},
+					{Path: "github.com/mongodb/mongo-go-driver/mongo"},
+					{Name: "bson2", Path: "gopkg.in/mgo.v2/bson"},
+				},
+			},
+			typeFields: []*structbuilder.FieldType{
+				{Name: "bson.M", ImportPath: "gopkg.in/mgo.v2/bson"},
+				{Name: "[]bson.ObjectId", ImportPath: "gopkg.in/mgo.v2/bson"},
+				{Name: "bson.Value", ImportPath: "github.com/mongodb/mongo-go-driver/bson"},
+			},
+			wantTypes: []string{"bson2.M", "[]bson2.ObjectId", "bson.Value"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			imps := resolveImports(tc.structs)
+			if !reflect.DeepEqual(imps.groups, tc.want) {
+				t.Errorf("expected %v but got %v", tc.want, imps.groups)
+			}
+
+			var types []string
+			for _, ft := range tc.typeFields {
+				types = append(types, imps.typeName(ft))
+			}
+			if !reflect.DeepEqual(types, tc.wantTypes) {
+				t.Errorf("expected %q but got %q", tc.wantTypes, types)
+			}
+		})
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	testCases := []struct {
+		importPath string
+		want       string
+	}{
+		{importPath: "time", want: "time"},
+		{importPath: "encoding/json", want: "json"},
+		{importPath: "github.com/shopspring/decimal", want: "decimal"},
+		{importPath: "github.com/go-redis/redis/v8", want: "redis"},
+		{importPath: "gopkg.in/yaml.v2", want: "yaml"},
+		{importPath: "github.com/satori/go.uuid", want: "gouuid"},
+		{importPath: "github.com/influxdata/influxdb-client-go", want: "influxdbclient"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.importPath, func(t *testing.T) {
+			if got := packageName(tc.importPath); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestQualifier(t *testing.T) {
+	testCases := []struct {
+		typeName string
+		want     string
+	}{
+		{typeName: "time.Time", want: "time"},
+		{typeName: "*time.Time", want: "time"},
+		{typeName: "[]decimal.Decimal", want: "decimal"},
+		{typeName: "map[string]bson.M", want: "bson"},
+		{typeName: "Status", want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.typeName, func(t *testing.T) {
+			if got := qualifier(tc.typeName); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package generate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+// indexOptions returns the code of the elements of an index's options, held
+// as Extended JSON.
+func indexOptions(extJSON string) ([]string, error) {
+	if extJSON == "" {
+		return nil, nil
+	}
+
+	doc, err := bson.ParseExtJSONObject(extJSON)
+	if err != nil {
+		return nil, fmt.Errorf("index options: %v", err)
+	}
+
+	return elementsCode(doc)
+}
+
+func elementsCode(doc *bson.Document) ([]string, error) {
+	var elems []string
+	iter := doc.Iterator()
+	for iter.Next() {
+		code, err := elementCode(iter.Element())
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, code)
+	}
+
+	return elems, iter.Err()
+}
+
+// elementCode returns the code constructing the element.
+func elementCode(e *bson.Element) (string, error) {
+	name, args, err := constructor(e.Value())
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return rawCode(e)
+	}
+
+	switch name {
+	case "DocumentFromElements":
+		name = "SubDocumentFromElements"
+	case "ArrayFromValues":
+		name = "ArrayFromElements"
+	}
+	args = append([]string{strconv.Quote(e.Key())}, args...)
+	return fmt.Sprintf("bson.EC.%s(%s)", name, strings.Join(args, ", ")), nil
+}
+
+// valueCode returns the code constructing the value.
+func valueCode(v *bson.Value) (string, error) {
+	name, args, err := constructor(v)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		code, err := rawCode(bson.EC.FromValue("", v))
+		return code + ".Value()", err
+	}
+
+	return fmt.Sprintf("bson.VC.%s(%s)", name, strings.Join(args, ", ")), nil
+}
+
+// constructor returns the name of the bson.VC function constructing the
+// value, along with the code of its arguments. The name is empty for the
+// types only constructed from their bytes.
+func constructor(v *bson.Value) (string, []string, error) {
+	switch v.Type() {
+	case bson.TypeDouble:
+		if f := v.Double(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return "Double", []string{strconv.FormatFloat(f, 'g', -1, 64)}, nil
+		}
+	case bson.TypeString:
+		return "String", []string{strconv.Quote(v.StringValue())}, nil
+	case bson.TypeEmbeddedDocument:
+		elems, err := elementsCode(v.MutableDocument())
+		return "DocumentFromElements", elems, err
+	case bson.TypeArray:
+		iter, err := v.MutableArray().Iterator()
+		if err != nil {
+			return "", nil, err
+		}
+		var values []string
+		for iter.Next() {
+			code, err := valueCode(iter.Value())
+			if err != nil {
+				return "", nil, err
+			}
+			values = append(values, code)
+		}
+		return "ArrayFromValues", values, iter.Err()
+	case bson.TypeBoolean:
+		return "Boolean", []string{strconv.FormatBool(v.Boolean())}, nil
+	case bson.TypeDateTime:
+		return "DateTime", []string{strconv.FormatInt(v.DateTime(), 10)}, nil
+	case bson.TypeNull:
+		return "Null", nil, nil
+	case bson.TypeRegex:
+		pattern, options := v.Regex()
+		return "Regex", []string{strconv.Quote(pattern), strconv.Quote(options)}, nil
+	case bson.TypeInt32:
+		return "Int32", []string{strconv.FormatInt(int64(v.Int32()), 10)}, nil
+	case bson.TypeInt64:
+		return "Int64", []string{strconv.FormatInt(v.Int64(), 10)}, nil
+	}
+
+	return "", nil, nil
+}
+
+// rawCode returns the code constructing the element from its bytes, for the
+// types which are rare in index options and need other packages to be
+// constructed otherwise.
+func rawCode(e *bson.Element) (string, error) {
+	data, err := e.MarshalBSON()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("bson.EC.FromBytes([]byte{")
+	for i, c := range data {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "0x%02x", c)
+	}
+	b.WriteString("})")
+
+	return b.String(), nil
+}
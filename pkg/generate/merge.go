@@ -0,0 +1,489 @@
+package generate
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generatedMethods are the names of the methods the generator writes for
+// some of the structs.
+var generatedMethods = map[string]struct{}{
+	"UnmarshalBSONValue": {},
+	"MarshalBSONValue":   {},
+	"UnmarshalJSON":      {},
+	"MarshalJSON":        {},
+	"Indexes":            {},
+}
+
+// KeepDirective marks the fields, types and values of an existing file that
+// survive regeneration.
+const KeepDirective = "typeprovider:keep"
+
+// mergeSource merges the newly generated source with the existing file it
+// replaces. The generated declarations win, except that:
+//   - fields marked with the keep directive replace the generated field of
+//     the same name or bson or json key, or are added when there isn't one;
+//   - doc comments on types and fields are carried over, as the generator
+//     never writes them;
+//   - functions and methods not generated are kept, unless their receiver is
+//     gone or they are named like the generator's, such as Indexes or
+//     DecodeOrder, in which case they must be marked with the keep directive
+//     to survive;
+//   - types, variables and constants marked with the keep directive are kept.
+func mergeSource(existing []byte, generated []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	oldFile, err := parser.ParseFile(fset, "existing.go", existing, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	newFile, err := parser.ParseFile(fset, "generated.go", generated, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &merger{
+		fset:      fset,
+		existing:  existing,
+		generated: generated,
+	}
+
+	newTypes := typeSpecs(newFile)
+	newNames := declNames(newFile)
+	oldTypes := typeSpecs(oldFile)
+	for name, oldSpec := range oldTypes {
+		if newSpec, ok := newTypes[name]; ok {
+			m.mergeType(oldSpec, newSpec)
+		}
+	}
+
+	source := applyEdits(generated, m.edits)
+
+	var kept [][]byte
+	types := make(map[string]struct{})
+	for name := range newTypes {
+		types[name] = struct{}{}
+	}
+	for _, decl := range oldFile.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE && hasKeep(gd.Doc) {
+			for _, spec := range gd.Specs {
+				types[spec.(*ast.TypeSpec).Name.Name] = struct{}{}
+			}
+		}
+	}
+	for _, decl := range oldFile.Decls {
+		if m.keepDecl(decl, newNames, types, oldTypes) {
+			kept = append(kept, m.text(m.existing, declStart(decl), decl.End()))
+		}
+	}
+	for _, k := range kept {
+		source = append(source, '\n')
+		source = append(source, k...)
+		source = append(source, '\n')
+	}
+
+	source, err = addImports(source, oldFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.Source(source)
+}
+
+type merger struct {
+	fset      *token.FileSet
+	existing  []byte
+	generated []byte
+	edits     []edit
+}
+
+// edit replaces the bytes of the generated source between start and end.
+type edit struct {
+	start, end int
+	text       []byte
+}
+
+func (m *merger) offset(p token.Pos) int {
+	return m.fset.Position(p).Offset
+}
+
+func (m *merger) text(src []byte, start token.Pos, end token.Pos) []byte {
+	return src[m.offset(start):m.offset(end)]
+}
+
+// mergeType carries the doc comments and kept fields of the existing type
+// over to the generated one.
+func (m *merger) mergeType(oldSpec *typeSpec, newSpec *typeSpec) {
+	if oldSpec.doc != nil && newSpec.doc == nil {
+		m.insert(newSpec.decl.Pos(), m.text(m.existing, oldSpec.doc.Pos(), oldSpec.doc.End()), "\n")
+	}
+
+	oldStruct, ok1 := oldSpec.spec.Type.(*ast.StructType)
+	newStruct, ok2 := newSpec.spec.Type.(*ast.StructType)
+	if !ok1 || !ok2 {
+		return
+	}
+
+	newFields := make(map[string]*ast.Field)
+	newKeys := make(map[string]*ast.Field)
+	for _, f := range newStruct.Fields.List {
+		newFields[fieldName(f)] = f
+		if key := fieldKey(f); key != "" {
+			newKeys[key] = f
+		}
+	}
+
+	replaced := make(map[*ast.Field]struct{})
+	for _, f := range oldStruct.Fields.List {
+		nf := newFields[fieldName(f)]
+		if hasKeep(f.Doc) || hasKeep(f.Comment) {
+			// a kept field also stands in for the generated field with the
+			// same key, which would otherwise be decoded twice.
+			var sameKey *ast.Field
+			if key := fieldKey(f); key != "" {
+				sameKey = newKeys[key]
+			}
+			if nf == nil {
+				nf, sameKey = sameKey, nil
+			}
+			if _, ok := replaced[nf]; ok {
+				nf = nil
+			}
+
+			text := m.text(m.existing, fieldStart(f), fieldEnd(f))
+			if nf != nil {
+				replaced[nf] = struct{}{}
+				m.edits = append(m.edits, edit{m.offset(fieldStart(nf)), m.offset(fieldEnd(nf)), text})
+			} else {
+				m.insert(newStruct.Fields.Closing, text, "\n")
+			}
+			if _, ok := replaced[sameKey]; sameKey != nil && !ok {
+				replaced[sameKey] = struct{}{}
+				m.remove(fieldStart(sameKey), fieldEnd(sameKey))
+			}
+			continue
+		}
+
+		if nf != nil && f.Doc != nil && nf.Doc == nil {
+			m.insert(nf.Pos(), m.text(m.existing, f.Doc.Pos(), f.Doc.End()), "\n")
+		}
+	}
+}
+
+// remove drops the generated source between start and end, along with the
+// line break following it.
+func (m *merger) remove(start token.Pos, end token.Pos) {
+	offset := m.offset(end)
+	if offset < len(m.generated) && m.generated[offset] == '\n' {
+		offset++
+	}
+	m.edits = append(m.edits, edit{m.offset(start), offset, nil})
+}
+
+func (m *merger) insert(p token.Pos, text []byte, sep string) {
+	offset := m.offset(p)
+	m.edits = append(m.edits, edit{offset, offset, append(append([]byte{}, text...), sep...)})
+}
+
+// keepDecl indicates whether a declaration of the existing file survives.
+func (m *merger) keepDecl(decl ast.Decl, newNames map[string]struct{}, types map[string]struct{}, oldTypes map[string]*typeSpec) bool {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if _, ok := newNames[funcName(d)]; ok {
+			return false
+		}
+		if generatedFunc(d, oldTypes) && !hasKeep(d.Doc) {
+			// the generator no longer writes it, so it is stale.
+			return false
+		}
+		if d.Recv != nil {
+			_, ok := types[receiverName(d)]
+			return ok
+		}
+		return true
+	case *ast.GenDecl:
+		if d.Tok == token.IMPORT || !hasKeep(d.Doc) {
+			return false
+		}
+		for _, name := range genDeclNames(d) {
+			if _, ok := newNames[name]; ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// generatedFunc indicates whether the function is named like one the
+// generator writes for a type of the existing file.
+func generatedFunc(d *ast.FuncDecl, oldTypes map[string]*typeSpec) bool {
+	if d.Recv != nil {
+		_, ok := generatedMethods[d.Name.Name]
+		return ok
+	}
+
+	if !strings.HasPrefix(d.Name.Name, "Decode") {
+		return false
+	}
+	_, ok := oldTypes[strings.TrimPrefix(d.Name.Name, "Decode")]
+	return ok
+}
+
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+
+	result := append([]byte{}, src...)
+	for _, e := range edits {
+		result = append(result[:e.start], append(append([]byte{}, e.text...), result[e.end:]...)...)
+	}
+
+	return result
+}
+
+// addImports adds the imports of the existing file used by the kept code.
+func addImports(source []byte, oldFile *ast.File) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "merged.go", source, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]struct{})
+	for _, spec := range file.Imports {
+		present[importName(spec)] = struct{}{}
+	}
+
+	full, err := parser.ParseFile(token.NewFileSet(), "merged.go", source, 0)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]struct{})
+	ast.Inspect(full, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = struct{}{}
+			}
+		}
+		return true
+	})
+
+	var lines []string
+	for _, spec := range oldFile.Imports {
+		name := importName(spec)
+		if _, ok := present[name]; ok {
+			continue
+		}
+		if _, ok := used[name]; !ok {
+			continue
+		}
+
+		line := spec.Path.Value
+		if spec.Name != nil {
+			line = spec.Name.Name + " " + line
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return source, nil
+	}
+
+	// the imports join the generated import declaration, or go right after
+	// the package clause when there is none.
+	offset := fset.Position(file.Name.End()).Offset
+	text := "\n\nimport (\n\t" + strings.Join(lines, "\n\t") + "\n)\n"
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT && gd.Rparen.IsValid() {
+			offset = fset.Position(gd.Rparen).Offset
+			text = "\t" + strings.Join(lines, "\n\t") + "\n"
+			break
+		}
+	}
+	return append(source[:offset:offset], append([]byte(text), source[offset:]...)...), nil
+}
+
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+
+	p, _ := strconv.Unquote(spec.Path.Value)
+	return packageName(p)
+}
+
+// typeSpec is a type declaration along with the doc comment, which is on
+// the declaration unless it is grouped.
+type typeSpec struct {
+	decl *ast.GenDecl
+	spec *ast.TypeSpec
+	doc  *ast.CommentGroup
+}
+
+func typeSpecs(file *ast.File) map[string]*typeSpec {
+	specs := make(map[string]*typeSpec)
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			specs[ts.Name.Name] = &typeSpec{decl: gd, spec: ts, doc: doc}
+		}
+	}
+
+	return specs
+}
+
+// declNames returns the names of the top-level declarations, with methods
+// named by their receiver.
+func declNames(file *ast.File) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			names[funcName(d)] = struct{}{}
+		case *ast.GenDecl:
+			for _, name := range genDeclNames(d) {
+				names[name] = struct{}{}
+			}
+		}
+	}
+
+	return names
+}
+
+func genDeclNames(d *ast.GenDecl) []string {
+	var names []string
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, n := range s.Names {
+				names = append(names, n.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+func funcName(d *ast.FuncDecl) string {
+	if d.Recv == nil {
+		return d.Name.Name
+	}
+
+	return receiverName(d) + "." + d.Name.Name
+}
+
+func receiverName(d *ast.FuncDecl) string {
+	expr := d.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+
+	return ""
+}
+
+func fieldName(f *ast.Field) string {
+	if len(f.Names) > 0 {
+		return f.Names[0].Name
+	}
+
+	// embedded fields are named by their type.
+	var buf bytes.Buffer
+	_ = format.Node(&buf, token.NewFileSet(), f.Type)
+	return buf.String()
+}
+
+// keyTags are the struct tags giving the key a field is decoded from.
+var keyTags = []string{"bson", "json"}
+
+// fieldKey returns the key a field is decoded from according to its struct
+// tags, or "" when they don't name one.
+func fieldKey(f *ast.Field) string {
+	if f.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return ""
+	}
+
+	for _, t := range keyTags {
+		value, ok := reflect.StructTag(tag).Lookup(t)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexByte(value, ','); i >= 0 {
+			value = value[:i]
+		}
+		if value != "" && value != "-" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func fieldStart(f *ast.Field) token.Pos {
+	if f.Doc != nil {
+		return f.Doc.Pos()
+	}
+
+	return f.Pos()
+}
+
+func fieldEnd(f *ast.Field) token.Pos {
+	if f.Comment != nil {
+		return f.Comment.End()
+	}
+
+	return f.End()
+}
+
+func declStart(decl ast.Decl) token.Pos {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	}
+
+	return decl.Pos()
+}
+
+func hasKeep(cg *ast.CommentGroup) bool {
+	if cg == nil {
+		return false
+	}
+
+	for _, c := range cg.List {
+		if strings.Contains(c.Text, KeepDirective) {
+			return true
+		}
+	}
+
+	return false
+}
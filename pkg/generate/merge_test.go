@@ -0,0 +1,91 @@
+package generate
+
+import "testing"
+
+func TestMergeSource(t *testing.T) {
+	testCases := []struct {
+		name      string
+		existing  string
+		generated string
+		want      string
+	}{
+		{
+			name:      "kept field replaces the generated one",
+			existing:  "package p\n\ntype Order struct {\n\tA int32 // typeprovider:keep\n\tB string\n}\n",
+			generated: "package p\n\ntype Order struct {\n\tA int64\n\tB *string\n}\n",
+			want:      "package p\n\ntype Order struct {\n\tA int32 // typeprovider:keep\n\tB *string\n}\n",
+		},
+		{
+			name:      "kept field is added",
+			existing:  "package p\n\ntype Order struct {\n\t// typeprovider:keep\n\tNote string\n}\n",
+			generated: "package p\n\ntype Order struct {\n\tA int32\n}\n",
+			want:      "package p\n\ntype Order struct {\n\tA int32\n\t// typeprovider:keep\n\tNote string\n}\n",
+		},
+		{
+			name:      "kept field replaces the generated one with the same key",
+			existing:  "package p\n\ntype Order struct {\n\tTotal decimal.Decimal `bson:\"amount\"` // typeprovider:keep\n}\n",
+			generated: "package p\n\ntype Order struct {\n\tA      int32   `bson:\"a\"`\n\tAmount float64 `bson:\"amount\"`\n}\n",
+			want:      "package p\n\ntype Order struct {\n\tA     int32           `bson:\"a\"`\n\tTotal decimal.Decimal `bson:\"amount\"` // typeprovider:keep\n}\n",
+		},
+		{
+			name:      "kept field drops the other generated one with the same key",
+			existing:  "package p\n\ntype Order struct {\n\tA int32 `json:\"amount,omitempty\"` // typeprovider:keep\n}\n",
+			generated: "package p\n\ntype Order struct {\n\tA      string  `json:\"a\"`\n\tAmount float64 `json:\"amount\"`\n}\n",
+			want:      "package p\n\ntype Order struct {\n\tA int32 `json:\"amount,omitempty\"` // typeprovider:keep\n}\n",
+		},
+		{
+			name:      "doc comments are carried over",
+			existing:  "package p\n\n// Order is an order.\ntype Order struct {\n\t// A is a.\n\tA int32\n}\n",
+			generated: "package p\n\ntype Order struct {\n\tA int64\n}\n",
+			want:      "package p\n\n// Order is an order.\ntype Order struct {\n\t// A is a.\n\tA int64\n}\n",
+		},
+		{
+			name:      "methods of remaining types are kept",
+			existing:  "package p\n\nimport \"fmt\"\n\ntype Order struct{}\n\ntype Gone struct{}\n\nfunc (o Order) String() string { return fmt.Sprint(1) }\n\nfunc (g Gone) String() string { return \"\" }\n\nfunc Helper() {}\n",
+			generated: "package p\n\ntype Order struct{}\n",
+			want:      "package p\n\nimport (\n\t\"fmt\"\n)\n\ntype Order struct{}\n\nfunc (o Order) String() string { return fmt.Sprint(1) }\n\nfunc Helper() {}\n",
+		},
+		{
+			name:      "imports of kept code are named like the generator names them",
+			existing:  "package p\n\nimport \"gopkg.in/yaml.v2\"\n\ntype Order struct{}\n\nfunc (o Order) YAML() ([]byte, error) { return yaml.Marshal(o) }\n",
+			generated: "package p\n\ntype Order struct{}\n",
+			want:      "package p\n\nimport (\n\t\"gopkg.in/yaml.v2\"\n)\n\ntype Order struct{}\n\nfunc (o Order) YAML() ([]byte, error) { return yaml.Marshal(o) }\n",
+		},
+		{
+			name:      "generated declarations win",
+			existing:  "package p\n\ntype Order struct{}\n\nfunc (Order) Indexes() int { return 1 }\n",
+			generated: "package p\n\ntype Order struct{}\n\nfunc (Order) Indexes() int { return 2 }\n",
+			want:      "package p\n\ntype Order struct{}\n\nfunc (Order) Indexes() int { return 2 }\n",
+		},
+		{
+			name:      "stale generated methods are dropped",
+			existing:  "package p\n\ntype Order struct{}\n\nfunc (Order) Indexes() int { return 1 }\n\nfunc (o *Order) UnmarshalJSON(data []byte) error { return nil }\n\nfunc DecodeOrder(data []byte) (interface{}, error) { return nil, nil }\n\nfunc DecodeOther(data []byte) (interface{}, error) { return nil, nil }\n",
+			generated: "package p\n\ntype Order struct{}\n",
+			want:      "package p\n\ntype Order struct{}\n\nfunc DecodeOther(data []byte) (interface{}, error) { return nil, nil }\n",
+		},
+		{
+			name:      "kept methods named like generated ones survive",
+			existing:  "package p\n\ntype Order struct{}\n\n// MarshalJSON writes the order by hand.\n// typeprovider:keep\nfunc (o Order) MarshalJSON() ([]byte, error) { return nil, nil }\n",
+			generated: "package p\n\ntype Order struct{}\n",
+			want:      "package p\n\ntype Order struct{}\n\n// MarshalJSON writes the order by hand.\n// typeprovider:keep\nfunc (o Order) MarshalJSON() ([]byte, error) { return nil, nil }\n",
+		},
+		{
+			name:      "kept types and their methods survive",
+			existing:  "package p\n\ntype Order struct{}\n\n// typeprovider:keep\ntype Status int\n\nfunc (s Status) Valid() bool { return s > 0 }\n\ntype Unmarked int\n",
+			generated: "package p\n\ntype Order struct{}\n",
+			want:      "package p\n\ntype Order struct{}\n\n// typeprovider:keep\ntype Status int\n\nfunc (s Status) Valid() bool { return s > 0 }\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergeSource([]byte(tc.existing), []byte(tc.generated))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package generate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// DefaultHeader is the comment written at the top of generated files.
+const DefaultHeader = "/* CODE GENERATED AUTOMATICALLY WITH github.com/craiggwilson/go-typeproviders */"
+
+// Options configures the code generated. The zero value generates formatted
+// Go, written to stdout, with the fields in the order they were seen.
+type Options struct {
+	// Package is the name of the package holding the structs.
+	Package string
+	// EmbedStructs embeds structs instead of giving them names, except those
+	// that must be named.
+	EmbedStructs bool
+	// FieldOrder is the order of the fields in each struct.
+	FieldOrder FieldOrder
+	// OmitEmpty adds omitempty to the tags of the fields that can be empty:
+	// pointers, slices and maps.
+	OmitEmpty bool
+	// Header is the comment at the top of the file, written as is. Empty
+	// uses DefaultHeader.
+	Header string
+	// Format is the form of the output.
+	Format Format
+
+	// Writer receives the output of Generate. Nil uses stdout.
+	Writer io.Writer
+	// Merge makes GenerateFile update an existing file rather than replace
+	// it, keeping what was added to it by hand, as described in mergeSource.
+	// It requires the Go format.
+	Merge bool
+}
+
+// FieldOrder is the order of the fields in a struct.
+type FieldOrder string
+
+const (
+	// FieldOrderData keeps the fields in the order they were first seen.
+	FieldOrderData FieldOrder = "data"
+	// FieldOrderName sorts the fields by name. The fields of tuples stay in
+	// the order of their positions.
+	FieldOrderName FieldOrder = "name"
+)
+
+// ParseFieldOrder parses the name of a field order. Empty is FieldOrderData.
+func ParseFieldOrder(s string) (FieldOrder, error) {
+	switch o := FieldOrder(s); o {
+	case "":
+		return FieldOrderData, nil
+	case FieldOrderData, FieldOrderName:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown field order %q", s)
+	}
+}
+
+// Format is the form of the output.
+type Format string
+
+const (
+	// FormatGo is Go source formatted by gofmt.
+	FormatGo Format = "go"
+	// FormatGoUnformatted is the Go source as the templates render it, which
+	// helps tell why it doesn't format.
+	FormatGoUnformatted Format = "gounformatted"
+	// FormatJSON is the structs as JSON, for tools generating code of their
+	// own.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses the name of a format. Empty is FormatGo.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatGo, nil
+	case FormatGo, FormatGoUnformatted, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", s)
+	}
+}
+
+// sortFields sorts the fields of the struct and of those embedded in it by
+// name.
+func sortFields(s *structbuilder.Struct) {
+	if !s.Tuple {
+		structbuilder.SortFieldsByName(s.Fields)
+	}
+
+	for _, f := range s.Fields {
+		if es := f.Type.Innermost().EmbeddedStruct; es != nil {
+			sortFields(es)
+		}
+	}
+	for _, v := range s.Variants {
+		sortFields(v.Struct)
+	}
+}
+
+// omitEmpty adds omitempty to the tags of the fields of the struct, and of
+// those embedded in it, that can be empty.
+func omitEmpty(s *structbuilder.Struct) {
+	for _, f := range s.Fields {
+		ft := f.Type
+		if ft.CanBeNull || ft.MapValue != nil || (ft.ArrayCount > 0 && (len(ft.ArrayLengths) == 0 || ft.ArrayLengths[0] == 0)) {
+			for i, tag := range f.Tags {
+				f.Tags[i] = omitEmptyTag(tag)
+			}
+		}
+
+		if es := ft.Innermost().EmbeddedStruct; es != nil {
+			omitEmpty(es)
+		}
+	}
+	for _, v := range s.Variants {
+		omitEmpty(v.Struct)
+	}
+}
+
+// omitEmptyTag adds omitempty to a tag written as name:"value", unless it
+// already has it or the field is skipped.
+func omitEmptyTag(tag string) string {
+	i := strings.Index(tag, `:"`)
+	if i < 0 || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+
+	value := tag[i+2 : len(tag)-1]
+	if value == "-" || strings.Contains(value, ",omitempty") {
+		return tag
+	}
+
+	return tag[:i+2] + value + `,omitempty"`
+}
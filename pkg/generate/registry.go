@@ -0,0 +1,118 @@
+package generate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/spf13/pflag"
+)
+
+// Provider describes a kind of input structs can be generated from, so that
+// it can be offered on the command line and in the configuration file
+// without the command knowing about it. Providers outside this module
+// register themselves in an init function, and appear in the command line
+// of a main package importing them.
+type Provider struct {
+	// Name is the name of the command and of the provider in the
+	// configuration file.
+	Name string
+	// Usage describes the arguments, such as [filename]...
+	Usage string
+	// Short and Long are the descriptions shown in the help.
+	Short string
+	Long  string
+
+	// Flags declares the provider's flags, whose values are set by the
+	// command line or the options of a job in the configuration file.
+	Flags func(fs *pflag.FlagSet)
+	// New makes a StructProvider from the context. If the StructProvider is
+	// also an io.Closer, it is closed once the code is generated.
+	New func(pc *ProviderContext) (StructProvider, error)
+}
+
+// ProviderContext holds what a registered provider is made from, whether it
+// runs as a command or as a job of the configuration file.
+type ProviderContext struct {
+	// Flags are the parsed flags, or the options of a job.
+	Flags *pflag.FlagSet
+	// Args are the arguments, or the inputs of a job resolved against the
+	// configuration file's directory.
+	Args []string
+	// Overrides are the manual decisions about fields, which the provider
+	// should apply to the structs it builds.
+	Overrides overrides.Set
+	// TagNames are the struct tags given to each field. Empty uses the
+	// provider's default.
+	TagNames []string
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]*Provider)
+)
+
+// builtinProviderNames are the names of the providers built into the
+// command, which have commands and job settings of their own rather than
+// being registered.
+var builtinProviderNames = map[string]struct{}{
+	"bson":      {},
+	"json":      {},
+	"mongodb":   {},
+	"mongodump": {},
+	"schema":    {},
+}
+
+// RegisterProvider makes a provider available by its name. It panics if the
+// provider is incomplete or the name is already taken, including by a
+// built-in provider.
+func RegisterProvider(p *Provider) {
+	if p == nil || p.Name == "" || p.New == nil {
+		panic("generate: RegisterProvider requires a name and a New function")
+	}
+	if _, ok := builtinProviderNames[p.Name]; ok {
+		panic(fmt.Sprintf("generate: provider %s is built in", p.Name))
+	}
+
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[p.Name]; ok {
+		panic(fmt.Sprintf("generate: provider %s is already registered", p.Name))
+	}
+
+	providers[p.Name] = p
+}
+
+// LookupProvider returns the provider registered with the name, or nil.
+func LookupProvider(name string) *Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	return providers[name]
+}
+
+// Providers returns the registered providers ordered by name.
+func Providers() []*Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	results := make([]*Provider, 0, len(providers))
+	for _, p := range providers {
+		results = append(results, p)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	return results
+}
+
+// FlagSet makes the provider's flag set, with its flags declared.
+func (p *Provider) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet(p.Name, pflag.ContinueOnError)
+	if p.Flags != nil {
+		p.Flags(fs)
+	}
+
+	return fs
+}
@@ -0,0 +1,105 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/spf13/pflag"
+)
+
+type staticProvider []*structbuilder.Struct
+
+func (p staticProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
+	return p, nil
+}
+
+func newStaticProvider(pc *ProviderContext) (StructProvider, error) {
+	return staticProvider(nil), nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	RegisterProvider(&Provider{Name: "test-b", New: newStaticProvider})
+	RegisterProvider(&Provider{Name: "test-a", New: newStaticProvider})
+
+	testCases := []struct {
+		name      string
+		provider  *Provider
+		wantPanic string
+	}{
+		{
+			name:      "nil",
+			wantPanic: "generate: RegisterProvider requires a name and a New function",
+		},
+		{
+			name:      "no name",
+			provider:  &Provider{New: newStaticProvider},
+			wantPanic: "generate: RegisterProvider requires a name and a New function",
+		},
+		{
+			name:      "no New function",
+			provider:  &Provider{Name: "test-c"},
+			wantPanic: "generate: RegisterProvider requires a name and a New function",
+		},
+		{
+			name:      "already registered",
+			provider:  &Provider{Name: "test-a", New: newStaticProvider},
+			wantPanic: "generate: provider test-a is already registered",
+		},
+		{
+			name:      "built in",
+			provider:  &Provider{Name: "mongodb", New: newStaticProvider},
+			wantPanic: "generate: provider mongodb is built in",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if got := fmt.Sprint(recover()); got != tc.wantPanic {
+					t.Errorf("expected panic %q but got %q", tc.wantPanic, got)
+				}
+			}()
+
+			RegisterProvider(tc.provider)
+		})
+	}
+
+	if p := LookupProvider("test-a"); p == nil || p.Name != "test-a" {
+		t.Errorf("expected test-a to be found but got %v", p)
+	}
+	if p := LookupProvider("mongodb"); p != nil {
+		t.Errorf("expected the built-in mongodb to be missing but got %v", p)
+	}
+
+	var names []string
+	for _, p := range Providers() {
+		names = append(names, p.Name)
+	}
+	if want := []string{"test-a", "test-b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %q but got %q", want, names)
+	}
+}
+
+func TestProviderFlagSet(t *testing.T) {
+	p := &Provider{
+		Name: "test",
+		Flags: func(fs *pflag.FlagSet) {
+			fs.String("uri", "mongodb://localhost", "")
+		},
+		New: newStaticProvider,
+	}
+
+	fs := p.FlagSet()
+	if err := fs.Set("uri", "mongodb://db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fs.Lookup("uri").Value.String(); got != "mongodb://db" {
+		t.Errorf("expected %q but got %q", "mongodb://db", got)
+	}
+	if err := fs.Set("missing", "x"); err == nil {
+		t.Errorf("expected an error for an undeclared flag")
+	}
+}
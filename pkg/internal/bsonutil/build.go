@@ -2,31 +2,171 @@ package bsonutil
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
 	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
 	"github.com/mongodb/mongo-go-driver/bson"
 )
 
 func BuildStruct(name string, tb *TypeBuilder) *structbuilder.Struct {
+	// without overrides, building can't fail.
+	s, _ := BuildStructWithConfig(name, tb, BuildConfig{})
+	return s
+}
+
+// BuildConfig holds information used to refine the structs being built.
+type BuildConfig struct {
+	// GeoPaths are the dotted paths of fields known to hold GeoJSON, such as
+	// those covered by a 2dsphere index.
+	GeoPaths []string
+	// TimePaths are the dotted paths of fields known to hold dates, such as
+	// the time field of a time-series collection.
+	TimePaths []string
+	// Types are the BSON types of the fields at the dotted paths, such as
+	// those declared by a collection's validator. They win over the data.
+	Types map[string]bson.Type
+	// RequiredPaths are the dotted paths of fields that are always present
+	// and never null.
+	RequiredPaths []string
+	// Comments are notes attached to the fields at the dotted paths.
+	Comments map[string]string
+	// Overrides are the manual decisions about fields, which win over
+	// everything else.
+	Overrides overrides.Set
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those, or only json when Plain.
+	TagNames []string
+	// Plain builds types for ordinary JSON rather than BSON: integers are int
+	// when they fit in 32 bits and int64 otherwise, decimal128 values are
+	// json.Number, and values only ever seen as null are interface{}.
+	Plain bool
+}
+
+// defaultTagNames are the struct tags given to each field when none are
+// configured.
+var defaultTagNames = []string{"bson", "json"}
+
+// BuildStructWithConfig builds a struct from the type builder, using the
+// configuration to refine the types. It fails when the overrides can't be
+// applied.
+func BuildStructWithConfig(name string, tb *TypeBuilder, cfg BuildConfig) (*structbuilder.Struct, error) {
+	b := &builder{
+		name:          name,
+		geoPaths:      make(map[string]struct{}),
+		timePaths:     make(map[string]struct{}),
+		requiredPaths: make(map[string]struct{}),
+		types:         cfg.Types,
+		comments:      cfg.Comments,
+		overrides:     cfg.Overrides,
+		tagNames:      cfg.TagNames,
+		plain:         cfg.Plain,
+	}
+	if len(b.tagNames) == 0 {
+		b.tagNames = defaultTagNames
+		if b.plain {
+			// ordinary JSON has no use for bson tags.
+			b.tagNames = []string{"json"}
+		}
+	}
+	for _, path := range cfg.GeoPaths {
+		b.geoPaths[path] = struct{}{}
+	}
+	for _, path := range cfg.TimePaths {
+		b.timePaths[path] = struct{}{}
+	}
+	for _, path := range cfg.RequiredPaths {
+		b.requiredPaths[path] = struct{}{}
+	}
+
+	var s *structbuilder.Struct
+	if len(tb.Variants) > 0 {
+		s = b.buildUnion(name, tb)
+	} else {
+		s = b.buildStruct(name, "", tb, nil)
+	}
+
+	return s, b.err
+}
+
+type builder struct {
+	name          string
+	geoPaths      map[string]struct{}
+	timePaths     map[string]struct{}
+	requiredPaths map[string]struct{}
+	types         map[string]bson.Type
+	comments      map[string]string
+	overrides     overrides.Set
+	tagNames      []string
+	plain         bool
+
+	// err is the first override which couldn't be applied.
+	err error
+}
+
+// ancestor is a struct being built further up the tree, along with the
+// field name that was followed to descend from it.
+type ancestor struct {
+	s   *structbuilder.Struct
+	tb  *TypeBuilder
+	via string
+}
+
+func (b *builder) buildStruct(name string, docPath string, tb *TypeBuilder, ancestors []ancestor) *structbuilder.Struct {
 	s := structbuilder.Struct{
 		Name: naming.Struct(name),
 	}
 
 	for _, fb := range tb.Fields {
+		fieldDocPath := joinPath(docPath, fb.Name)
+		override := b.overrides.Lookup(b.name, fieldDocPath)
+		if override != nil && override.Exclude {
+			continue
+		}
+
 		exportedFieldName := naming.ExportedField(fb.Name)
+		if override != nil && override.Name != "" {
+			exportedFieldName = override.Name
+		}
 		path := s.Name + exportedFieldName
-		fieldType := selectType(path, tb.Count, fb.TypeBuilder)
-		if fieldType.ArrayCount > 0 {
+		fieldAncestors := append(ancestors[:len(ancestors):len(ancestors)], ancestor{s: &s, tb: tb, via: fb.Name})
+
+		var fieldType structbuilder.FieldType
+		if override != nil && override.Type != "" {
+			fieldType = structbuilder.FieldType{
+				Name:       override.Type,
+				ImportPath: override.Import,
+				CanBeNull:  b.canBeNull(fieldDocPath, tb.DocumentCount, fb.TypeBuilder),
+			}
+		} else {
+			fieldType = b.selectType(path, fieldDocPath, tb.DocumentCount, fb.TypeBuilder, fieldAncestors)
+		}
+		if comment, ok := b.comments[fieldDocPath]; ok {
+			fieldType.Comment = joinComments(fieldType.Comment, comment)
+		}
+		if fieldType.ArrayCount > 0 && (override == nil || override.Name == "") {
 			exportedFieldName = naming.Pluralize(exportedFieldName)
 		}
+		if override != nil && override.Name != "" && fieldNameTaken(&s, exportedFieldName) && b.err == nil {
+			b.err = fmt.Errorf("%s.%s: the name %s is already used by another field", b.name, fieldDocPath, exportedFieldName)
+		}
+		exportedFieldName = uniqueFieldName(&s, exportedFieldName)
+
+		tags := b.fieldTags(fb.Name)
+		if override != nil {
+			tags = override.ApplyTags(tags)
+			if override.Nullable != nil {
+				fieldType.CanBeNull = *override.Nullable
+			}
+		}
+
 		s.Fields = append(s.Fields, &structbuilder.Field{
 			Name: exportedFieldName,
-			Tags: []string{
-				fmt.Sprintf(`"bson:%s"`, fb.Name),
-				fmt.Sprintf(`"json:%s"`, fb.Name),
-			},
+			Tags: tags,
 			Type: &fieldType,
 		})
 	}
@@ -34,65 +174,319 @@ func BuildStruct(name string, tb *TypeBuilder) *structbuilder.Struct {
 	return &s
 }
 
-func selectType(path string, seenCount uint, tb *TypeBuilder) structbuilder.FieldType {
-	canBeNull := false
-	totalTypeCount := uint(0)
+// canBeNull indicates whether the values seen in tb at the dotted path can
+// be null: they were explicitly null or missing from some of the documents
+// that could have held them, and the path isn't required.
+func (b *builder) canBeNull(docPath string, seenCount uint, tb *TypeBuilder) bool {
+	if _, ok := b.requiredPaths[docPath]; ok {
+		return false
+	}
 
-	var fieldTypes []structbuilder.FieldType
+	return tb.NullCount > 0 || seenCount > tb.Count
+}
 
-	if tb.Fields != nil {
-		// we found a document
-		totalTypeCount += tb.Count
+func (b *builder) selectType(path string, docPath string, seenCount uint, tb *TypeBuilder, ancestors []ancestor) structbuilder.FieldType {
+	canBeNull := b.canBeNull(docPath, seenCount, tb)
 
-		rs := BuildStruct(path, tb)
-		fieldTypes = append(fieldTypes, structbuilder.FieldType{
-			Name:           rs.Name,
-			EmbeddedStruct: rs,
-		})
+	if _, ok := b.timePaths[docPath]; ok {
+		return structbuilder.FieldType{
+			Name:       "time.Time",
+			ImportPath: "time",
+			CanBeNull:  canBeNull,
+		}
 	}
-	if tb.Array != nil {
-		// we found an array
-		totalTypeCount += tb.Array.Count
-		elementFieldType := selectType(path, tb.Count, tb.Array)
-		elementFieldType.ArrayCount++
-		fieldTypes = append(fieldTypes, elementFieldType)
-	}
-	for key, primitiveCount := range tb.Primitives {
-		if key == "null" {
-			canBeNull = true
-			continue
+	if t, ok := b.types[docPath]; ok {
+		typeName, importPath := b.primitiveType(mapPrimitiveTypeName(t))
+		return structbuilder.FieldType{
+			Name:       typeName,
+			ImportPath: importPath,
+			CanBeNull:  canBeNull,
 		}
-		totalTypeCount += primitiveCount
+	}
+
+	var fieldTypes []structbuilder.FieldType
 
-		typeName, importPath := typeNameAndImportPath(key)
+	if tb.DocumentCount > 0 {
+		// we found a document
+		if tb.MapValues != nil {
+			// the document had too many distinct keys to be a struct.
+			valueType := b.selectType(path+"Value", joinPath(docPath, "*"), tb.MapValues.Count, tb.MapValues, ancestors)
+			fieldTypes = append(fieldTypes, structbuilder.FieldType{
+				MapValue: &valueType,
+			})
+		} else if gs := b.selectGeoStruct(docPath, tb); gs != nil {
+			fieldTypes = append(fieldTypes, structbuilder.FieldType{
+				Name:           gs.Name,
+				EmbeddedStruct: gs,
+			})
+		} else if a := recursiveAncestor(tb, ancestors); a != nil {
+			// the document has the same shape as one of its ancestors, so
+			// refer back to it instead of building an ever deeper struct.
+			a.s.Recursive = true
+			fieldTypes = append(fieldTypes, structbuilder.FieldType{
+				Name:      a.s.Name,
+				CanBeNull: true,
+			})
+		} else {
+			rs := b.buildStruct(path, docPath, tb, ancestors)
+			fieldTypes = append(fieldTypes, structbuilder.FieldType{
+				Name:           rs.Name,
+				EmbeddedStruct: rs,
+			})
+		}
+	}
+	if tb.ArrayCount > 0 {
+		// we found an array
+		fieldTypes = append(fieldTypes, b.selectArrayType(path, docPath, tb, ancestors))
+	}
+	for _, key := range b.widenNumbers(tb.Primitives) {
+		typeName, importPath := b.primitiveType(key)
 		fieldTypes = append(fieldTypes, structbuilder.FieldType{
 			Name:       typeName,
 			ImportPath: importPath,
 		})
 	}
 
-	if seenCount > totalTypeCount {
-		canBeNull = true
-	}
-
 	switch len(fieldTypes) {
 	case 0:
-		typeName, importPath := typeNameAndImportPath(mapPrimitiveTypeName(bson.TypeUndefined))
+		// only nulls were seen; the raw type is already a pointer.
+		typeName, importPath := b.primitiveType(mapPrimitiveTypeName(bson.TypeUndefined))
 		return structbuilder.FieldType{
 			Name:       typeName,
 			ImportPath: importPath,
-			CanBeNull:  true,
 		}
 	case 1:
-		fieldTypes[0].CanBeNull = canBeNull
+		// a nil slice or map already represents a null or missing value, and self
+		// references must stay pointers regardless of the data.
+		if fieldTypes[0].ArrayCount == 0 && fieldTypes[0].MapValue == nil {
+			fieldTypes[0].CanBeNull = fieldTypes[0].CanBeNull || canBeNull
+		}
 		return fieldTypes[0]
 	default:
 		return structbuilder.FieldType{
-			Name: "blah",
+			Name:    mixedTypeName,
+			Comment: mixedComment,
 		}
 	}
 }
 
+// selectArrayType picks the type for the arrays seen in tb. Arrays that always
+// have the same length become Go arrays when their elements share a type, or
+// tuple structs when each position has a type of its own.
+func (b *builder) selectArrayType(path string, docPath string, tb *TypeBuilder, ancestors []ancestor) structbuilder.FieldType {
+	if tb.Array.Count == 0 {
+		// every array was empty, so there is nothing to infer from.
+		return structbuilder.FieldType{
+			Name:       "interface{}",
+			ArrayCount: 1,
+			Comment:    "TODO: element type never observed",
+		}
+	}
+
+	length := 0
+	if tb.hasFixedLength() {
+		length = int(tb.MaxArrayLength)
+	}
+
+	elementFieldType := b.selectType(path, docPath, tb.Array.Count, tb.Array, ancestors)
+	if isMixed(elementFieldType) && length > 0 {
+		if ts := b.buildTuple(path, docPath, tb, ancestors); ts != nil {
+			// the driver only finds the tuple's unmarshaler through a
+			// pointer, so tuples are always pointers.
+			return structbuilder.FieldType{
+				Name:           ts.Name,
+				CanBeNull:      true,
+				EmbeddedStruct: ts,
+			}
+		}
+	}
+
+	elementFieldType.ArrayCount++
+	elementFieldType.ArrayLengths = append([]int{length}, elementFieldType.ArrayLengths...)
+	return elementFieldType
+}
+
+// buildTuple builds a struct with a field for each position of the fixed
+// length arrays seen in tb. It returns nil if any single position holds mixed
+// types.
+func (b *builder) buildTuple(path string, docPath string, tb *TypeBuilder, ancestors []ancestor) *structbuilder.Struct {
+	s := structbuilder.Struct{
+		Name:  naming.Struct(path),
+		Tuple: true,
+		Plain: b.plain,
+	}
+
+	for i, ptb := range tb.Positions {
+		fieldName := fmt.Sprintf("Item%d", i)
+		fieldType := b.selectType(s.Name+fieldName, joinPath(docPath, strconv.Itoa(i)), tb.ArrayCount, ptb, ancestors)
+		if isMixed(fieldType) {
+			return nil
+		}
+		tags := b.fieldTags(strconv.Itoa(i))
+		if !b.plain && indexOf(b.tagNames, "bson") < 0 {
+			// the positions are decoded from BSON by their bson tags.
+			tags = append([]string{fmt.Sprintf(`bson:"%d"`, i)}, tags...)
+		}
+		s.Fields = append(s.Fields, &structbuilder.Field{
+			Name: fieldName,
+			Tags: tags,
+			Type: &fieldType,
+		})
+	}
+
+	return &s
+}
+
+// recursiveAncestor finds the closest ancestor the document is compatible
+// with. A document is compatible with an ancestor when it contains the field
+// that was followed down from that ancestor and every one of its fields
+// exists in the ancestor with the same kinds of values.
+func recursiveAncestor(tb *TypeBuilder, ancestors []ancestor) *ancestor {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		a := &ancestors[i]
+		if tb.field(a.via) == nil {
+			continue
+		}
+
+		if tb.isShapeSubsetOf(a.tb) {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// uniqueFieldName returns the name, numbered when another field of the struct
+// already has it, as happens with keys such as _id and id.
+func uniqueFieldName(s *structbuilder.Struct, name string) string {
+	unique := name
+	for i := 2; fieldNameTaken(s, unique); i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	return unique
+}
+
+// fieldNameTaken indicates whether a field of the struct has the name.
+func fieldNameTaken(s *structbuilder.Struct, name string) bool {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldTags returns the struct tags for a field with the given key.
+func (b *builder) fieldTags(key string) []string {
+	tags := make([]string, 0, len(b.tagNames))
+	for _, name := range b.tagNames {
+		tags = append(tags, fmt.Sprintf(`%s:"%s"`, name, key))
+	}
+
+	return tags
+}
+
+// joinComments joins the non-empty comments, each collapsed onto a single
+// line as they follow the field, such as validator descriptions written over
+// several lines.
+func joinComments(comments ...string) string {
+	var results []string
+	for _, c := range comments {
+		if c = strings.Join(strings.Fields(c), " "); c != "" {
+			results = append(results, c)
+		}
+	}
+
+	return strings.Join(results, "; ")
+}
+
+// joinPath appends the key to the dotted document path.
+func joinPath(docPath string, key string) string {
+	if docPath == "" {
+		return key
+	}
+
+	return docPath + "." + key
+}
+
+// mixedTypeName is used when values of incompatible types were seen, along
+// with mixedComment to tell it from values that are interface{} otherwise.
+const (
+	mixedTypeName = "interface{}"
+	mixedComment  = "TODO: values of mixed types"
+)
+
+// isMixed indicates whether the type was selected for values of incompatible
+// types.
+func isMixed(ft structbuilder.FieldType) bool {
+	return ft.Name == mixedTypeName && ft.Comment == mixedComment
+}
+
+// numericTypeNames are the numeric primitive type names, each able to hold
+// the values of those before it.
+var numericTypeNames = []string{"int32", "int64", "float64"}
+
+// plainNumericTypeNames are the numeric primitive type names in plain mode,
+// where decimal128 holds integers too large for an int64 and becomes a
+// json.Number able to hold any number.
+var plainNumericTypeNames = []string{"int32", "int64", "float64", decimalTypeName}
+
+// widenNumbers returns the sorted primitive type names, collapsing differing
+// numeric types into the one able to hold all of them.
+func (b *builder) widenNumbers(primitives map[string]uint) []string {
+	ranks := numericTypeNames
+	if b.plain {
+		ranks = plainNumericTypeNames
+	}
+
+	var names []string
+	numeric := -1
+	for name := range primitives {
+		rank := indexOf(ranks, name)
+		if rank < 0 {
+			names = append(names, name)
+		} else if rank > numeric {
+			numeric = rank
+		}
+	}
+
+	if numeric >= 0 {
+		names = append(names, ranks[numeric])
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// plainTypeNames replace the primitive type names in plain mode.
+var plainTypeNames = map[string]string{
+	"int32":         "int",
+	decimalTypeName: "json.Number encoding/json",
+	rawTypeName:     "interface{}",
+}
+
+// primitiveType returns the type name and import path for the primitive
+// type name.
+func (b *builder) primitiveType(name string) (string, string) {
+	if plainName, ok := plainTypeNames[name]; ok && b.plain {
+		name = plainName
+	}
+
+	return typeNameAndImportPath(name)
+}
+
 func typeNameAndImportPath(name string) (string, string) {
 	parts := strings.SplitN(name, " ", 2)
 	typeName := parts[0]
@@ -0,0 +1,299 @@
+package bsonutil
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+func TestBuildStructRecursion(t *testing.T) {
+	testCases := []struct {
+		name string
+		docs []string
+		want []string
+	}{
+		{
+			name: "children of the same shape",
+			docs: []string{`{"name":"a","children":[{"name":"b","children":[{"name":"c","children":[]}]}]}`},
+			want: []string{"Node", "Name string", "Childrens []*Node"},
+		},
+		{
+			name: "parent of the same shape",
+			docs: []string{`{"name":"a","parent":{"name":"b","parent":{"name":"c"}}}`},
+			want: []string{"Node", "Name string", "Parent *Node"},
+		},
+		{
+			name: "different shapes are not recursive",
+			docs: []string{`{"name":"a","owner":{"id":1}}`},
+			want: []string{"Node", "Name string", "Owner struct NodeOwner", "NodeOwner", "ID int64"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := describe(buildFromJSON(t, "nodes", "", tc.docs...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildStructEmptyAndNull(t *testing.T) {
+	testCases := []struct {
+		name string
+		docs []string
+		want []string
+	}{
+		{
+			name: "only empty arrays",
+			docs: []string{`{"a":[]}`, `{"a":[]}`},
+			want: []string{"Thing", "As []interface{} // TODO: element type never observed"},
+		},
+		{
+			name: "empty arrays don't change the element type",
+			docs: []string{`{"a":[]}`, `{"a":[1]}`},
+			want: []string{"Thing", "As []int64"},
+		},
+		{
+			name: "only null",
+			docs: []string{`{"a":null}`},
+			want: []string{"Thing", "A *bson.Value"},
+		},
+		{
+			name: "null makes a pointer",
+			docs: []string{`{"a":"x"}`, `{"a":null}`},
+			want: []string{"Thing", "A *string"},
+		},
+		{
+			name: "missing makes a pointer",
+			docs: []string{`{"a":"x","b":true}`, `{"b":false}`},
+			want: []string{"Thing", "A *string", "B bool"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := describe(buildFromJSON(t, "things", "", tc.docs...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildStructFixedLengthArrays(t *testing.T) {
+	testCases := []struct {
+		name      string
+		doc       string
+		count     int
+		want      []string
+		wantTuple bool
+	}{
+		{
+			name:      "tuple",
+			doc:       `{"p":[1,"x",true]}`,
+			count:     minFixedLengthArrays,
+			want:      []string{"Thing", "P *struct ThingP", "ThingP", "Item0 int64", "Item1 string", "Item2 bool"},
+			wantTuple: true,
+		},
+		{
+			name:  "too few arrays for a tuple",
+			doc:   `{"p":[1,"x",true]}`,
+			count: minFixedLengthArrays - 1,
+			want:  []string{"Thing", "Ps []interface{} // TODO: values of mixed types"},
+		},
+		{
+			name:  "fixed length array",
+			doc:   `{"p":[1.5,2.5]}`,
+			count: minFixedLengthArrays,
+			want:  []string{"Thing", "Ps [2]float64"},
+		},
+		{
+			name:  "too few arrays for a fixed length",
+			doc:   `{"p":[1.5,2.5]}`,
+			count: minFixedLengthArrays - 1,
+			want:  []string{"Thing", "Ps []float64"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs := make([]string, tc.count)
+			for i := range docs {
+				docs[i] = tc.doc
+			}
+
+			s := buildFromJSON(t, "things", "", docs...)
+			got := describe(s)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+			if es := s.Fields[0].Type.EmbeddedStruct; (es != nil && es.Tuple) != tc.wantTuple {
+				t.Errorf("expected tuple to be %v", tc.wantTuple)
+			}
+		})
+	}
+}
+
+func TestBuildStructMixedArrays(t *testing.T) {
+	got := describe(buildFromJSON(t, "things", "", `{"p":[1,"x"]}`, `{"p":["y",2,3]}`))
+	want := []string{"Thing", "Ps []interface{} // TODO: values of mixed types"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestBuildStructOverrides(t *testing.T) {
+	nullable := true
+
+	testCases := []struct {
+		name      string
+		overrides overrides.Set
+		want      []string
+		wantTags  []string
+		wantErr   string
+	}{
+		{
+			name:      "name",
+			overrides: overrides.Set{"orders.a": {Name: "Alpha"}},
+			want:      []string{"Order", "Alpha int64", "Items []struct OrderItem", "OrderItem", "Price float64"},
+		},
+		{
+			name:      "type and nullable",
+			overrides: overrides.Set{"orders.items.price": {Type: "decimal.Decimal", Import: "github.com/shopspring/decimal", Nullable: &nullable}},
+			want:      []string{"Order", "A int64", "Items []struct OrderItem", "OrderItem", "Price *decimal.Decimal"},
+		},
+		{
+			name:      "excluded everywhere",
+			overrides: overrides.Set{"*.items": {Exclude: true}},
+			want:      []string{"Order", "A int64"},
+		},
+		{
+			name:      "other structs are left alone",
+			overrides: overrides.Set{"users.a": {Exclude: true}},
+			want:      []string{"Order", "A int64", "Items []struct OrderItem", "OrderItem", "Price float64"},
+		},
+		{
+			name:      "tags",
+			overrides: overrides.Set{"orders.a": {Tags: map[string]string{"json": "", "db": "a"}}},
+			want:      []string{"Order", "A int64", "Items []struct OrderItem", "OrderItem", "Price float64"},
+			wantTags:  []string{`bson:"a"`, `db:"a"`},
+		},
+		{
+			name:      "name used by another field",
+			overrides: overrides.Set{"orders.items": {Name: "A"}},
+			wantErr:   "orders.items: the name A is already used by another field",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tb := NewTypeBuilder()
+			includeJSON(t, tb, `{"a":1,"items":[{"price":1.5}]}`)
+
+			s, err := BuildStructWithConfig("orders", tb, BuildConfig{Overrides: tc.overrides})
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q but got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := describe(s); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+			if tc.wantTags != nil && !reflect.DeepEqual(s.Fields[0].Tags, tc.wantTags) {
+				t.Errorf("expected tags %q but got %q", tc.wantTags, s.Fields[0].Tags)
+			}
+		})
+	}
+}
+
+// buildFromJSON builds the struct for the documents, written as Extended
+// JSON.
+func buildFromJSON(t *testing.T, name string, discriminator string, docs ...string) *structbuilder.Struct {
+	t.Helper()
+
+	tb := NewTypeBuilder()
+	tb.Discriminator = discriminator
+	includeJSON(t, tb, docs...)
+
+	return BuildStruct(name, tb)
+}
+
+// includeJSON includes the documents, written as Extended JSON, in the type
+// builder.
+func includeJSON(t *testing.T, tb *TypeBuilder, docs ...string) {
+	t.Helper()
+
+	for _, doc := range docs {
+		d, err := bson.ParseExtJSONObject(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+		tb.IncludeDocument(d)
+	}
+}
+
+// describe lists the name of the struct followed by its fields as name, type
+// and comment, then does the same for the structs embedded in them and the
+// variants.
+func describe(s *structbuilder.Struct) []string {
+	results := []string{s.Name}
+	var children []*structbuilder.Struct
+	for _, f := range s.Fields {
+		field := strings.TrimSpace(f.Name + " " + typeString(f.Type))
+		if f.Type.Comment != "" {
+			field += " // " + f.Type.Comment
+		}
+		results = append(results, field)
+		if es := f.Type.Innermost().EmbeddedStruct; es != nil {
+			children = append(children, es)
+		}
+	}
+	for _, child := range children {
+		results = append(results, describe(child)...)
+	}
+	for _, v := range s.Variants {
+		results = append(results, describe(v.Struct)...)
+	}
+
+	return results
+}
+
+func typeString(ft *structbuilder.FieldType) string {
+	if ft.MapValue != nil {
+		return "map[string]" + typeString(ft.MapValue)
+	}
+
+	var b strings.Builder
+	if len(ft.ArrayLengths) > 0 {
+		for _, n := range ft.ArrayLengths {
+			if n == 0 {
+				b.WriteString("[]")
+			} else {
+				b.WriteString("[" + strconv.Itoa(n) + "]")
+			}
+		}
+	} else {
+		b.WriteString(strings.Repeat("[]", ft.ArrayCount))
+	}
+	if ft.CanBeNull {
+		b.WriteString("*")
+	}
+	if ft.EmbeddedStruct != nil {
+		b.WriteString("struct ")
+	}
+	b.WriteString(ft.Name)
+
+	return b.String()
+}
@@ -0,0 +1,178 @@
+package bsonutil
+
+import (
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// geoCoordinateDepths maps each GeoJSON type to how deeply its coordinates
+// are nested in arrays.
+var geoCoordinateDepths = map[string]int{
+	"Point":              1,
+	"LineString":         2,
+	"MultiPoint":         2,
+	"Polygon":            3,
+	"MultiLineString":    3,
+	"MultiPolygon":       4,
+	"GeometryCollection": 0,
+}
+
+// geoFieldNames are the fields allowed in a GeoJSON object.
+var geoFieldNames = map[string]struct{}{
+	"type":        {},
+	"coordinates": {},
+	"geometries":  {},
+	"bbox":        {},
+	"crs":         {},
+}
+
+// geoGeometryName is the struct used when more than one kind of GeoJSON
+// object was seen.
+const geoGeometryName = "GeoGeometry"
+
+// selectGeoStruct returns the shared struct for the GeoJSON objects seen in
+// tb, or nil if they aren't GeoJSON. Documents at paths known to hold GeoJSON
+// fall back to the general geometry when their exact kind can't be
+// determined.
+func (b *builder) selectGeoStruct(docPath string, tb *TypeBuilder) *structbuilder.Struct {
+	_, known := b.geoPaths[docPath]
+
+	typeField := tb.field("type")
+	if typeField == nil || typeField.DocumentCount > 0 || typeField.ArrayCount > 0 {
+		return nil
+	}
+	if _, ok := typeField.Primitives["string"]; !ok || len(typeField.Primitives) != 1 {
+		return nil
+	}
+	if tb.field("coordinates") == nil && tb.field("geometries") == nil {
+		return nil
+	}
+	for _, fb := range tb.Fields {
+		if _, ok := geoFieldNames[fb.Name]; !ok {
+			return nil
+		}
+	}
+
+	var kinds []string
+	for value := range typeField.StringValues {
+		if _, ok := geoCoordinateDepths[value]; !ok {
+			if known {
+				return b.geoStruct(geoGeometryName)
+			}
+			return nil
+		}
+		kinds = append(kinds, value)
+	}
+
+	switch len(kinds) {
+	case 0:
+		if known {
+			return b.geoStruct(geoGeometryName)
+		}
+		return nil
+	case 1:
+		if kinds[0] == "GeometryCollection" {
+			return b.geoStruct("Geo" + kinds[0])
+		}
+		if coords := tb.field("coordinates"); coords != nil && coordinateDepth(coords.TypeBuilder) == geoCoordinateDepths[kinds[0]] {
+			return b.geoStruct("Geo" + kinds[0])
+		}
+		if known {
+			return b.geoStruct(geoGeometryName)
+		}
+		return nil
+	default:
+		return b.geoStruct(geoGeometryName)
+	}
+}
+
+// coordinateDepth returns how deeply numbers are nested in arrays, or -1 if
+// anything other than arrays of numbers was seen.
+func coordinateDepth(tb *TypeBuilder) int {
+	depth := 0
+	for tb.ArrayCount > 0 {
+		if tb.DocumentCount > 0 || len(tb.Primitives) > 0 {
+			return -1
+		}
+		depth++
+		tb = tb.Array
+	}
+
+	if tb.DocumentCount > 0 {
+		return -1
+	}
+	for name := range tb.Primitives {
+		switch name {
+		case "float64", "int64", "int32":
+		default:
+			return -1
+		}
+	}
+
+	return depth
+}
+
+// geoStruct makes the shared struct with the given name, which holds every
+// member of a GeoJSON object of its kind.
+func (b *builder) geoStruct(name string) *structbuilder.Struct {
+	s := &structbuilder.Struct{
+		Name:   name,
+		Shared: true,
+	}
+
+	s.Fields = append(s.Fields, &structbuilder.Field{
+		Name: "Type",
+		Tags: b.fieldTags("type"),
+		Type: &structbuilder.FieldType{Name: "string"},
+	})
+
+	switch name {
+	case geoGeometryName:
+		s.Fields = append(s.Fields,
+			&structbuilder.Field{
+				Name: "Coordinates",
+				Tags: b.fieldTags("coordinates"),
+				Type: &structbuilder.FieldType{Name: "interface{}"},
+			},
+			&structbuilder.Field{
+				Name: "Geometries",
+				Tags: b.fieldTags("geometries"),
+				Type: &structbuilder.FieldType{Name: geoGeometryName, ArrayCount: 1},
+			},
+		)
+	case "GeoGeometryCollection":
+		s.Fields = append(s.Fields, &structbuilder.Field{
+			Name: "Geometries",
+			Tags: b.fieldTags("geometries"),
+			Type: &structbuilder.FieldType{
+				Name:           geoGeometryName,
+				ArrayCount:     1,
+				EmbeddedStruct: b.geoStruct(geoGeometryName),
+			},
+		})
+	default:
+		s.Fields = append(s.Fields, &structbuilder.Field{
+			Name: "Coordinates",
+			Tags: b.fieldTags("coordinates"),
+			Type: &structbuilder.FieldType{
+				Name:       "float64",
+				ArrayCount: geoCoordinateDepths[name[len("Geo"):]],
+			},
+		})
+	}
+
+	// the optional members, left out when empty as they are in the data.
+	s.Fields = append(s.Fields,
+		&structbuilder.Field{
+			Name: "BBox",
+			Tags: b.fieldTags("bbox,omitempty"),
+			Type: &structbuilder.FieldType{Name: "float64", ArrayCount: 1},
+		},
+		&structbuilder.Field{
+			Name: "CRS",
+			Tags: b.fieldTags("crs,omitempty"),
+			Type: &structbuilder.FieldType{MapValue: &structbuilder.FieldType{Name: "interface{}"}},
+		},
+	)
+
+	return s
+}
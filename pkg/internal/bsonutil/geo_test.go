@@ -0,0 +1,57 @@
+package bsonutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectGeoStruct(t *testing.T) {
+	members := []string{"BBox []float64", "CRS map[string]interface{}"}
+	geo := func(fields ...string) []string {
+		return append(fields, members...)
+	}
+
+	testCases := []struct {
+		name string
+		docs []string
+		want []string
+	}{
+		{
+			name: "point",
+			docs: []string{`{"loc":{"type":"Point","coordinates":[1.5,2.5]}}`},
+			want: append([]string{"Place", "Loc struct GeoPoint"}, geo("GeoPoint", "Type string", "Coordinates []float64")...),
+		},
+		{
+			name: "polygon with bbox and crs",
+			docs: []string{`{"loc":{"type":"Polygon","coordinates":[[[1.5,2.5],[3.5,4.5]]],"bbox":[1,2,3,4],"crs":{"type":"name","properties":{"name":"x"}}}}`},
+			want: append([]string{"Place", "Loc struct GeoPolygon"}, geo("GeoPolygon", "Type string", "Coordinates [][][]float64")...),
+		},
+		{
+			name: "several kinds",
+			docs: []string{
+				`{"loc":{"type":"Point","coordinates":[1.5,2.5]}}`,
+				`{"loc":{"type":"LineString","coordinates":[[1.5,2.5],[3.5,4.5]]}}`,
+			},
+			want: append([]string{"Place", "Loc struct GeoGeometry"}, geo("GeoGeometry", "Type string", "Coordinates interface{}", "Geometries []GeoGeometry")...),
+		},
+		{
+			name: "coordinates of the wrong depth",
+			docs: []string{`{"loc":{"type":"Point","coordinates":[[1.5,2.5]]}}`},
+			want: []string{"Place", "Loc struct PlaceLoc", "PlaceLoc", "Type string", "Coordinates [][]float64"},
+		},
+		{
+			name: "other members",
+			docs: []string{`{"loc":{"type":"Point","coordinates":[1.5,2.5],"label":"x"}}`},
+			want: []string{"Place", "Loc struct PlaceLoc", "PlaceLoc", "Type string", "Coordinates []float64", "Label string"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := describe(buildFromJSON(t, "places", "", tc.docs...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
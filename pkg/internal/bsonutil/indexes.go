@@ -0,0 +1,192 @@
+package bsonutil
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+// IDIndexName is the name of the index every collection has on _id.
+const IDIndexName = "_id_"
+
+// indexSpecFields are the fields of an index specification read into the
+// index itself, or which only describe it as it's stored.
+var indexSpecFields = map[string]struct{}{
+	"name":               {},
+	"key":                {},
+	"unique":             {},
+	"sparse":             {},
+	"expireAfterSeconds": {},
+	"v":                  {},
+	"ns":                 {},
+}
+
+// ParseIndex reads an index specification, as returned by listIndexes or
+// written by mongodump.
+func ParseIndex(doc *bson.Document) (*structbuilder.Index, error) {
+	index := &structbuilder.Index{}
+
+	if v, err := doc.LookupErr("name"); err == nil {
+		index.Name, _ = v.StringValueOK()
+	}
+	if v, err := doc.LookupErr("unique"); err == nil {
+		index.Unique, _ = v.BooleanOK()
+	}
+	if v, err := doc.LookupErr("sparse"); err == nil {
+		index.Sparse, _ = v.BooleanOK()
+	}
+	if v, err := doc.LookupErr("expireAfterSeconds"); err == nil {
+		n, ok, err := numberValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: expireAfterSeconds: %v", index.Name, err)
+		}
+		if ok {
+			index.TTL = true
+			index.ExpireAfterSeconds = n
+		}
+	}
+
+	if v, err := doc.LookupErr("key"); err == nil {
+		if keys, ok := v.MutableDocumentOK(); ok {
+			iter := keys.Iterator()
+			for iter.Next() {
+				e := iter.Element()
+				switch e.Key() {
+				case textIndexKey:
+					index.Keys = append(index.Keys, textIndexKeys(doc)...)
+					continue
+				case textIndexTermKey:
+					continue
+				}
+
+				key := structbuilder.IndexKey{
+					Field: e.Key(),
+				}
+				if kind, ok := e.Value().StringValueOK(); ok {
+					key.Kind = kind
+				} else {
+					n, ok, err := numberValue(e.Value())
+					if err != nil {
+						return nil, fmt.Errorf("index %s: key %s: %v", index.Name, e.Key(), err)
+					}
+					if ok {
+						key.Direction = n
+					}
+				}
+				index.Keys = append(index.Keys, key)
+			}
+		}
+	}
+
+	options := bson.NewDocument()
+	iter := doc.Iterator()
+	for iter.Next() {
+		if _, ok := indexSpecFields[iter.Element().Key()]; !ok {
+			options.Append(iter.Element())
+		}
+	}
+	if options.Len() > 0 {
+		extJSON, err := options.ToExtJSONErr(true)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %v", index.Name, err)
+		}
+		index.Options = extJSON
+	}
+
+	return index, nil
+}
+
+// The keys a text index is stored with in place of the fields it covers,
+// which are found in its weights.
+const (
+	textIndexKey     = "_fts"
+	textIndexTermKey = "_ftsx"
+)
+
+// textIndexKeys returns the keys of the fields covered by a text index.
+func textIndexKeys(doc *bson.Document) []structbuilder.IndexKey {
+	var keys []structbuilder.IndexKey
+	if v, err := doc.LookupErr("weights"); err == nil {
+		if weights, ok := v.MutableDocumentOK(); ok {
+			iter := weights.Iterator()
+			for iter.Next() {
+				keys = append(keys, structbuilder.IndexKey{
+					Field: iter.Element().Key(),
+					Kind:  "text",
+				})
+			}
+		}
+	}
+
+	return keys
+}
+
+// numberValue reads a number regardless of its BSON type. It fails when the
+// number doesn't fit in an int32.
+func numberValue(v *bson.Value) (int32, bool, error) {
+	if n, ok := v.Int32OK(); ok {
+		return n, true, nil
+	}
+	if n, ok := v.Int64OK(); ok {
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return 0, false, fmt.Errorf("%d is out of range", n)
+		}
+		return int32(n), true, nil
+	}
+	if n, ok := v.DoubleOK(); ok {
+		if n < math.MinInt32 || n > math.MaxInt32 || n != math.Trunc(n) {
+			return 0, false, fmt.Errorf("%v is out of range", n)
+		}
+		return int32(n), true, nil
+	}
+
+	return 0, false, nil
+}
+
+// ApplyIndexes refines the types using the indexes: GeoJSON for 2dsphere
+// indexes, dates for TTL indexes, and comments for unique indexes.
+func ApplyIndexes(cfg *BuildConfig, indexes []*structbuilder.Index) {
+	for _, index := range indexes {
+		for _, key := range index.Keys {
+			if key.Kind == "2dsphere" {
+				cfg.GeoPaths = append(cfg.GeoPaths, key.Field)
+			}
+		}
+
+		if index.TTL && len(index.Keys) == 1 {
+			cfg.TimePaths = append(cfg.TimePaths, index.Keys[0].Field)
+			AddComment(cfg, index.Keys[0].Field, fmt.Sprintf("expires after %ds", index.ExpireAfterSeconds))
+		}
+
+		if index.Unique {
+			if len(index.Keys) == 1 {
+				AddComment(cfg, index.Keys[0].Field, "unique")
+				continue
+			}
+
+			var fields []string
+			for _, key := range index.Keys {
+				fields = append(fields, key.Field)
+			}
+			for _, key := range index.Keys {
+				AddComment(cfg, key.Field, "unique with "+strings.Join(fields, ", "))
+			}
+		}
+	}
+}
+
+// AddComment attaches a comment to the field at the dotted path, after any
+// comment already there.
+func AddComment(cfg *BuildConfig, docPath string, comment string) {
+	if cfg.Comments == nil {
+		cfg.Comments = make(map[string]string)
+	}
+	if existing := cfg.Comments[docPath]; existing != "" {
+		comment = existing + "; " + comment
+	}
+
+	cfg.Comments[docPath] = comment
+}
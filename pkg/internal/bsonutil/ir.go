@@ -0,0 +1,297 @@
+package bsonutil
+
+import (
+	"fmt"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+// rawAlias names the primitives without a Go type of their own in a schema.
+const rawAlias = "raw"
+
+// primitiveAliases maps the names primitives are counted by to the
+// $jsonSchema bsonType aliases naming them in a schema.
+var primitiveAliases = map[string]string{
+	"[]byte":         "binData",
+	"bool":           "bool",
+	"time.Time time": "date",
+	decimalTypeName:  "decimal",
+	"float64":        "double",
+	"int32":          "int",
+	"int64":          "long",
+	"objectid.ObjectID github.com/mongodb/mongo-go-driver/bson/objectid": "objectId",
+	"string":    "string",
+	rawTypeName: rawAlias,
+}
+
+// primitiveName maps a bsonType alias back to the name primitives are counted
+// by.
+func primitiveName(alias string) (string, error) {
+	if alias == rawAlias {
+		return rawTypeName, nil
+	}
+	if t, ok := schemaTypes[alias]; ok {
+		return mapPrimitiveTypeName(t), nil
+	}
+
+	return "", fmt.Errorf("unknown bsonType %q", alias)
+}
+
+// typeAlias finds the bsonType alias of a BSON type.
+func typeAlias(t bson.Type) string {
+	for alias, st := range schemaTypes {
+		if st == t {
+			return alias
+		}
+	}
+
+	return rawAlias
+}
+
+// CollectionSchema describes what was learned about the documents a struct
+// is built from. The tags and overrides of the configuration are left out,
+// as they are decided when building.
+func CollectionSchema(name string, tb *TypeBuilder, cfg BuildConfig, indexes []*structbuilder.Index) *schema.Collection {
+	c := &schema.Collection{
+		Name:          name,
+		Type:          SchemaType(tb),
+		GeoPaths:      cfg.GeoPaths,
+		TimePaths:     cfg.TimePaths,
+		RequiredPaths: cfg.RequiredPaths,
+		Comments:      cfg.Comments,
+		Indexes:       indexes,
+		Plain:         cfg.Plain,
+	}
+	for path, t := range cfg.Types {
+		if c.Types == nil {
+			c.Types = make(map[string]string)
+		}
+		c.Types[path] = typeAlias(t)
+	}
+
+	return c
+}
+
+// SchemaType describes the values seen by the type builder.
+func SchemaType(tb *TypeBuilder) *schema.Type {
+	if tb == nil {
+		return nil
+	}
+
+	t := &schema.Type{
+		Count:               tb.Count,
+		NullCount:           tb.NullCount,
+		StringValues:        tb.StringValues,
+		TooManyStringValues: tb.TooManyStringValues,
+		DocumentCount:       tb.DocumentCount,
+		MapValues:           SchemaType(tb.MapValues),
+		ArrayCount:          tb.ArrayCount,
+		EmptyArrayCount:     tb.EmptyArrayCount,
+		MinArrayLength:      tb.MinArrayLength,
+		MaxArrayLength:      tb.MaxArrayLength,
+		Array:               SchemaType(tb.Array),
+		Discriminator:       tb.Discriminator,
+		TooManyVariants:     tb.TooManyVariants,
+	}
+	for name, count := range tb.Primitives {
+		if t.Primitives == nil {
+			t.Primitives = make(map[string]uint)
+		}
+		t.Primitives[primitiveAliases[name]] += count
+	}
+	for _, fb := range tb.Fields {
+		t.Fields = append(t.Fields, &schema.Field{Name: fb.Name, Type: SchemaType(fb.TypeBuilder)})
+	}
+	for _, ptb := range tb.Positions {
+		t.Positions = append(t.Positions, SchemaType(ptb))
+	}
+	for _, vb := range tb.Variants {
+		t.Variants = append(t.Variants, &schema.Variant{Value: vb.Value, Type: SchemaType(vb.TypeBuilder)})
+	}
+
+	return t
+}
+
+// TypeBuilderFromSchema makes a type builder holding the values described by
+// the schema type, as if they had been seen again.
+func TypeBuilderFromSchema(t *schema.Type) (*TypeBuilder, error) {
+	tb := NewTypeBuilder()
+	if t == nil {
+		return tb, nil
+	}
+
+	tb.Count = t.Count
+	tb.NullCount = t.NullCount
+	tb.StringValues = t.StringValues
+	tb.TooManyStringValues = t.TooManyStringValues
+	tb.DocumentCount = t.DocumentCount
+	tb.ArrayCount = t.ArrayCount
+	tb.EmptyArrayCount = t.EmptyArrayCount
+	tb.MinArrayLength = t.MinArrayLength
+	tb.MaxArrayLength = t.MaxArrayLength
+	tb.Discriminator = t.Discriminator
+	tb.TooManyVariants = t.TooManyVariants
+
+	for alias, count := range t.Primitives {
+		name, err := primitiveName(alias)
+		if err != nil {
+			return nil, err
+		}
+		if tb.Primitives == nil {
+			tb.Primitives = make(map[string]uint)
+		}
+		tb.Primitives[name] += count
+	}
+
+	var err error
+	if t.MapValues != nil {
+		if tb.MapValues, err = TypeBuilderFromSchema(t.MapValues); err != nil {
+			return nil, err
+		}
+	}
+	if t.Array != nil {
+		if tb.Array, err = TypeBuilderFromSchema(t.Array); err != nil {
+			return nil, err
+		}
+	}
+	for _, pt := range t.Positions {
+		ptb, err := TypeBuilderFromSchema(pt)
+		if err != nil {
+			return nil, err
+		}
+		tb.Positions = append(tb.Positions, ptb)
+	}
+	for _, f := range t.Fields {
+		ftb, err := TypeBuilderFromSchema(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		tb.Fields = append(tb.Fields, &FieldBuilder{Name: f.Name, TypeBuilder: ftb})
+	}
+	for _, v := range t.Variants {
+		vtb, err := TypeBuilderFromSchema(v.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", v.Value, err)
+		}
+		tb.Variants = append(tb.Variants, &VariantBuilder{Value: v.Value, TypeBuilder: vtb})
+	}
+
+	return tb, nil
+}
+
+// BuildSchema builds a struct for each collection of the schema, giving each
+// field the tags and applying the overrides.
+func BuildSchema(s *schema.Schema, tagNames []string, ovs overrides.Set) ([]*structbuilder.Struct, error) {
+	var results []*structbuilder.Struct
+	for _, c := range s.Collections {
+		tb, err := TypeBuilderFromSchema(c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Name, err)
+		}
+
+		cfg := BuildConfig{
+			GeoPaths:      c.GeoPaths,
+			TimePaths:     c.TimePaths,
+			RequiredPaths: c.RequiredPaths,
+			Comments:      c.Comments,
+			Overrides:     ovs,
+			TagNames:      tagNames,
+			Plain:         c.Plain,
+		}
+		for path, alias := range c.Types {
+			t, ok := schemaTypes[alias]
+			if !ok {
+				return nil, fmt.Errorf("%s: %s: unknown bsonType %q", c.Name, path, alias)
+			}
+			if cfg.Types == nil {
+				cfg.Types = make(map[string]bson.Type)
+			}
+			cfg.Types[path] = t
+		}
+
+		result, err := BuildStructWithConfig(c.Name, tb, cfg)
+		if err != nil {
+			return nil, err
+		}
+		result.Indexes = c.Indexes
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// MergeSchema merges the collections of src into dst as if the documents of
+// both had been seen together: the counts of the collections with the same
+// name are summed and the others are added.
+func MergeSchema(dst *schema.Schema, src *schema.Schema) error {
+	for _, sc := range src.Collections {
+		var dc *schema.Collection
+		for _, c := range dst.Collections {
+			if c.Name == sc.Name {
+				dc = c
+				break
+			}
+		}
+		if dc == nil {
+			dst.Collections = append(dst.Collections, sc)
+			continue
+		}
+
+		if err := mergeCollection(dc, sc); err != nil {
+			return fmt.Errorf("%s: %v", dc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// mergeCollection merges src into dst. What src knows beyond the data is
+// more recent, so it wins.
+func mergeCollection(dst *schema.Collection, src *schema.Collection) error {
+	tb, err := TypeBuilderFromSchema(dst.Type)
+	if err != nil {
+		return err
+	}
+	other, err := TypeBuilderFromSchema(src.Type)
+	if err != nil {
+		return err
+	}
+	tb.Merge(other)
+	dst.Type = SchemaType(tb)
+
+	dst.GeoPaths = unionPaths(dst.GeoPaths, src.GeoPaths)
+	dst.TimePaths = unionPaths(dst.TimePaths, src.TimePaths)
+	if src.RequiredPaths != nil || src.Types != nil || src.Comments != nil {
+		// these come from the collection's metadata, which replaces what
+		// was known before.
+		dst.RequiredPaths = src.RequiredPaths
+		dst.Types = src.Types
+		dst.Comments = src.Comments
+	}
+	if src.Indexes != nil {
+		dst.Indexes = src.Indexes
+	}
+	dst.Plain = src.Plain
+
+	return nil
+}
+
+func unionPaths(paths []string, others []string) []string {
+	for _, other := range others {
+		found := false
+		for _, p := range paths {
+			if p == other {
+				found = true
+				break
+			}
+		}
+		if !found {
+			paths = append(paths, other)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,85 @@
+package bsonutil
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
+)
+
+func TestMergeSchema(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dst     string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "adds other collections",
+			dst:  `{"version":1,"collections":[{"name":"a","type":{"count":1,"documentCount":1}}]}`,
+			src:  `{"version":1,"collections":[{"name":"b","type":{"count":2,"documentCount":2}}]}`,
+			want: `{"version":1,"collections":[{"name":"a","type":{"count":1,"documentCount":1}},{"name":"b","type":{"count":2,"documentCount":2}}]}`,
+		},
+		{
+			name: "sums counts",
+			dst:  `{"version":1,"collections":[{"name":"a","type":{"count":2,"documentCount":2,"fields":[{"name":"x","count":2,"primitives":{"string":2},"stringValues":{"p":2}}]}}]}`,
+			src:  `{"version":1,"collections":[{"name":"a","type":{"count":3,"documentCount":3,"fields":[{"name":"x","count":1,"nullCount":1},{"name":"y","count":3,"primitives":{"int":3}}]}}]}`,
+			want: `{"version":1,"collections":[{"name":"a","type":{"count":5,"documentCount":5,"fields":[{"name":"x","count":3,"nullCount":1,"primitives":{"string":2},"stringValues":{"p":2}},{"name":"y","count":3,"primitives":{"int":3}}]}}]}`,
+		},
+		{
+			name: "sums string values",
+			dst:  `{"version":1,"collections":[{"name":"a","type":{"count":1,"documentCount":1,"fields":[{"name":"x","count":1,"primitives":{"string":1},"stringValues":{"p":1}}]}}]}`,
+			src:  `{"version":1,"collections":[{"name":"a","type":{"count":2,"documentCount":2,"fields":[{"name":"x","count":2,"primitives":{"string":2},"stringValues":{"p":2,"q":0}}]}}]}`,
+			want: `{"version":1,"collections":[{"name":"a","type":{"count":3,"documentCount":3,"fields":[{"name":"x","count":3,"primitives":{"string":3},"stringValues":{"p":3,"q":0}}]}}]}`,
+		},
+		{
+			name: "metadata of src wins",
+			dst:  `{"version":1,"collections":[{"name":"a","type":{"count":1},"geoPaths":["g"],"requiredPaths":["r"],"comments":{"r":"old"},"indexes":[{"name":"i","keys":[{"field":"r","direction":1}]}]}]}`,
+			src:  `{"version":1,"collections":[{"name":"a","type":{"count":1},"geoPaths":["h"],"comments":{"r":"new"}}]}`,
+			want: `{"version":1,"collections":[{"name":"a","type":{"count":2},"geoPaths":["g","h"],"comments":{"r":"new"},"indexes":[{"name":"i","keys":[{"field":"r","direction":1}]}]}]}`,
+		},
+		{
+			name:    "unknown bsonType",
+			dst:     `{"version":1,"collections":[{"name":"a","type":{"count":1,"primitives":{"nope":1}}}]}`,
+			src:     `{"version":1,"collections":[{"name":"a","type":{"count":1}}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := readSchema(t, tc.dst)
+			err := MergeSchema(dst, readSchema(t, tc.src))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := json.Marshal(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func readSchema(t *testing.T, s string) *schema.Schema {
+	t.Helper()
+
+	result, err := schema.Read(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
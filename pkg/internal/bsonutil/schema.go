@@ -0,0 +1,126 @@
+package bsonutil
+
+import (
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+// schemaTypes maps the $jsonSchema bsonType aliases to the BSON types that
+// have a Go type of their own.
+var schemaTypes = map[string]bson.Type{
+	"binData":   bson.TypeBinary,
+	"bool":      bson.TypeBoolean,
+	"date":      bson.TypeDateTime,
+	"decimal":   bson.TypeDecimal128,
+	"double":    bson.TypeDouble,
+	"int":       bson.TypeInt32,
+	"long":      bson.TypeInt64,
+	"objectId":  bson.TypeObjectID,
+	"string":    bson.TypeString,
+	"timestamp": bson.TypeTimestamp,
+}
+
+// ApplyValidator refines the types using the $jsonSchema of a collection's
+// validator: the declared types of primitive fields, the required fields, and
+// the descriptions as comments. Other query operators are ignored.
+func ApplyValidator(cfg *BuildConfig, validator *bson.Document) {
+	v, err := validator.LookupErr("$jsonSchema")
+	if err != nil {
+		return
+	}
+	if schema, ok := v.MutableDocumentOK(); ok {
+		applySchema(cfg, "", schema)
+	}
+}
+
+func applySchema(cfg *BuildConfig, docPath string, schema *bson.Document) {
+	if v, err := schema.LookupErr("required"); err == nil {
+		if required, ok := v.MutableArrayOK(); ok {
+			iter, _ := required.Iterator()
+			for iter.Next() {
+				if name, ok := iter.Value().StringValueOK(); ok {
+					cfg.RequiredPaths = append(cfg.RequiredPaths, joinPath(docPath, name))
+				}
+			}
+		}
+	}
+
+	v, err := schema.LookupErr("properties")
+	if err != nil {
+		return
+	}
+	properties, ok := v.MutableDocumentOK()
+	if !ok {
+		return
+	}
+
+	iter := properties.Iterator()
+	for iter.Next() {
+		e := iter.Element()
+		property, ok := e.Value().MutableDocumentOK()
+		if !ok {
+			continue
+		}
+
+		path := joinPath(docPath, e.Key())
+		if v, err := property.LookupErr("description"); err == nil {
+			if description, ok := v.StringValueOK(); ok {
+				AddComment(cfg, path, description)
+			}
+		}
+
+		types, nullable := schemaBSONTypes(property)
+		if nullable {
+			cfg.RequiredPaths = removePath(cfg.RequiredPaths, path)
+		}
+		if len(types) != 1 {
+			continue
+		}
+		if t, ok := schemaTypes[types[0]]; ok {
+			if cfg.Types == nil {
+				cfg.Types = make(map[string]bson.Type)
+			}
+			cfg.Types[path] = t
+		} else if types[0] == "object" {
+			applySchema(cfg, path, property)
+		}
+	}
+}
+
+// schemaBSONTypes reads the bsonType of a property, which is either a single
+// alias or an array of them, separating out null.
+func schemaBSONTypes(property *bson.Document) ([]string, bool) {
+	v, err := property.LookupErr("bsonType")
+	if err != nil {
+		return nil, false
+	}
+	if alias, ok := v.StringValueOK(); ok {
+		return []string{alias}, false
+	}
+
+	var types []string
+	nullable := false
+	if aliases, ok := v.MutableArrayOK(); ok {
+		iter, _ := aliases.Iterator()
+		for iter.Next() {
+			alias, _ := iter.Value().StringValueOK()
+			if alias == "null" {
+				nullable = true
+				continue
+			}
+			types = append(types, alias)
+		}
+	}
+
+	return types, nullable
+}
+
+func removePath(paths []string, path string) []string {
+	var results []string
+	for _, p := range paths {
+		if p != path {
+			results = append(results, p)
+		}
+	}
+
+	return results
+}
@@ -1,6 +1,8 @@
 package bsonutil
 
 import (
+	"io"
+
 	"github.com/mongodb/mongo-go-driver/bson"
 )
 
@@ -16,11 +18,145 @@ type TypeBuilder struct {
 	Primitives map[string]uint
 
 	CanBeNull bool
-	Count     uint
+	// Count is the number of values seen, including nulls.
+	Count uint
+	// DocumentCount is the number of embedded documents seen.
+	DocumentCount uint
+	// ArrayCount is the number of arrays seen, including empty ones.
+	ArrayCount uint
+	// EmptyArrayCount is the number of arrays seen without any elements.
+	EmptyArrayCount uint
+	// NullCount is the number of explicit nulls seen.
+	NullCount uint
+
+	// StringValues holds the counts of the distinct string values seen. It
+	// is nil once more than maxTrackedStringValues have been seen.
+	StringValues map[string]uint
+	// TooManyStringValues indicates that the distinct string values were no
+	// longer tracked.
+	TooManyStringValues bool
+
+	// MapValues holds the values of every field once more than
+	// maxTrackedFields distinct keys have been seen, at which point the
+	// document is treated as a map.
+	MapValues *TypeBuilder
+
+	// Discriminator is the key of the field used to partition documents
+	// into variants.
+	Discriminator string
+	// Variants holds a builder for each discriminator value seen. It is nil
+	// once more than maxTrackedVariants have been seen.
+	Variants []*VariantBuilder
+	// TooManyVariants indicates that the variants were no longer tracked, so
+	// the documents are built as a single struct.
+	TooManyVariants bool
+
+	// Positions holds a builder for each of the first few array indexes.
+	Positions []*TypeBuilder
+	// MinArrayLength is the length of the shortest array seen.
+	MinArrayLength uint
+	// MaxArrayLength is the length of the longest array seen.
+	MaxArrayLength uint
+}
+
+// maxTrackedFields is the number of distinct keys tracked in a document before
+// it is treated as a map. This keeps memory bounded for documents keyed by
+// data, such as ids.
+const maxTrackedFields = 256
+
+// maxTrackedStringValues is the number of distinct string values tracked
+// before giving up on them.
+const maxTrackedStringValues = 32
+
+// maxTrackedVariants is the number of distinct discriminator values tracked
+// before giving up on variants. Each one holds a builder of its own, so this
+// keeps memory bounded when the discriminator isn't a small set of kinds.
+const maxTrackedVariants = 32
+
+// maxTrackedPositions is the number of array indexes tracked individually.
+// Longer arrays are only tracked as a whole.
+const maxTrackedPositions = 16
+
+// minFixedLengthArrays is the number of arrays which must be seen before their
+// length is considered fixed. Sampled data often holds only a few arrays of a
+// field, which can agree on their length by chance.
+const minFixedLengthArrays = 10
+
+// hasFixedLength indicates whether every array seen had the same length and
+// each of its positions was tracked.
+func (tb *TypeBuilder) hasFixedLength() bool {
+	return tb.ArrayCount >= minFixedLengthArrays &&
+		tb.MinArrayLength == tb.MaxArrayLength &&
+		tb.MaxArrayLength >= 2 &&
+		tb.MaxArrayLength <= maxTrackedPositions
 }
 
 func (tb *TypeBuilder) IncludeDocument(doc *bson.Document) {
 	tb.Count++
+	tb.includeDocument(doc)
+	if tb.Discriminator != "" {
+		tb.includeVariant(doc)
+	}
+}
+
+// IncludeReader includes every document in the stream of BSON documents.
+func (tb *TypeBuilder) IncludeReader(r io.Reader) error {
+	for {
+		doc := bson.NewDocument()
+		_, err := doc.ReadFrom(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		tb.IncludeDocument(doc)
+	}
+}
+
+func (tb *TypeBuilder) includeVariant(doc *bson.Document) {
+	v, err := doc.LookupErr(tb.Discriminator)
+	if err != nil {
+		return
+	}
+	value, ok := v.StringValueOK()
+	if !ok {
+		return
+	}
+
+	if vb := tb.variant(value); vb != nil {
+		vb.IncludeDocument(doc)
+	}
+}
+
+// variant returns the builder of the variant with the discriminator value,
+// adding it when it is new, or nil once too many variants have been seen.
+func (tb *TypeBuilder) variant(value string) *VariantBuilder {
+	if tb.TooManyVariants {
+		return nil
+	}
+
+	for _, vb := range tb.Variants {
+		if vb.Value == value {
+			return vb
+		}
+	}
+
+	if len(tb.Variants) == maxTrackedVariants {
+		tb.Variants = nil
+		tb.TooManyVariants = true
+		return nil
+	}
+
+	vb := NewVariantBuilder(value)
+	tb.Variants = append(tb.Variants, vb)
+	return vb
+}
+
+func (tb *TypeBuilder) includeDocument(doc *bson.Document) {
+	tb.DocumentCount++
 
 	iter := doc.Iterator()
 	for iter.Next() {
@@ -30,11 +166,20 @@ func (tb *TypeBuilder) IncludeDocument(doc *bson.Document) {
 }
 
 func (tb *TypeBuilder) includeField(name string, v *bson.Value) {
-	for _, fb := range tb.Fields {
-		if fb.Name == name {
-			fb.includeValue(v)
-			return
-		}
+	if tb.MapValues != nil {
+		tb.MapValues.includeValue(v)
+		return
+	}
+
+	if fb := tb.field(name); fb != nil {
+		fb.includeValue(v)
+		return
+	}
+
+	if len(tb.Fields) == maxTrackedFields {
+		tb.collapseToMap()
+		tb.MapValues.includeValue(v)
+		return
 	}
 
 	fb := NewFieldBuilder(name)
@@ -42,26 +187,201 @@ func (tb *TypeBuilder) includeField(name string, v *bson.Value) {
 	tb.Fields = append(tb.Fields, fb)
 }
 
+// collapseToMap merges the values of all the fields together, treating the
+// document as a map from then on.
+func (tb *TypeBuilder) collapseToMap() {
+	tb.MapValues = NewTypeBuilder()
+	for _, fb := range tb.Fields {
+		tb.MapValues.Merge(fb.TypeBuilder)
+	}
+
+	tb.Fields = nil
+}
+
+// Merge includes everything seen by other into tb.
+func (tb *TypeBuilder) Merge(other *TypeBuilder) {
+	if other.ArrayCount > 0 {
+		if tb.ArrayCount == 0 || other.MinArrayLength < tb.MinArrayLength {
+			tb.MinArrayLength = other.MinArrayLength
+		}
+		if other.MaxArrayLength > tb.MaxArrayLength {
+			tb.MaxArrayLength = other.MaxArrayLength
+		}
+	}
+
+	tb.Count += other.Count
+	tb.DocumentCount += other.DocumentCount
+	tb.ArrayCount += other.ArrayCount
+	tb.EmptyArrayCount += other.EmptyArrayCount
+	tb.NullCount += other.NullCount
+
+	for name, count := range other.Primitives {
+		if tb.Primitives == nil {
+			tb.Primitives = make(map[string]uint)
+		}
+		tb.Primitives[name] += count
+	}
+
+	if other.TooManyStringValues {
+		tb.StringValues = nil
+		tb.TooManyStringValues = true
+	}
+	for str, count := range other.StringValues {
+		tb.includeStringValue(str, count)
+		if tb.TooManyStringValues {
+			break
+		}
+	}
+
+	if other.Array != nil {
+		if tb.Array == nil {
+			tb.Array = NewTypeBuilder()
+		}
+		tb.Array.Merge(other.Array)
+	}
+	for i, ptb := range other.Positions {
+		if i == len(tb.Positions) {
+			tb.Positions = append(tb.Positions, NewTypeBuilder())
+		}
+		tb.Positions[i].Merge(ptb)
+	}
+
+	if other.MapValues != nil && tb.MapValues == nil {
+		tb.collapseToMap()
+	}
+	for _, ofb := range other.Fields {
+		tb.mergeField(ofb)
+	}
+	if other.MapValues != nil {
+		tb.MapValues.Merge(other.MapValues)
+	}
+
+	if tb.Discriminator == "" {
+		tb.Discriminator = other.Discriminator
+	}
+	if other.TooManyVariants {
+		tb.Variants = nil
+		tb.TooManyVariants = true
+	}
+	for _, ovb := range other.Variants {
+		if vb := tb.variant(ovb.Value); vb != nil {
+			vb.Merge(ovb.TypeBuilder)
+		}
+	}
+}
+
+func (tb *TypeBuilder) mergeField(ofb *FieldBuilder) {
+	if tb.MapValues != nil {
+		tb.MapValues.Merge(ofb.TypeBuilder)
+		return
+	}
+
+	if fb := tb.field(ofb.Name); fb != nil {
+		fb.Merge(ofb.TypeBuilder)
+		return
+	}
+
+	if len(tb.Fields) == maxTrackedFields {
+		tb.collapseToMap()
+		tb.MapValues.Merge(ofb.TypeBuilder)
+		return
+	}
+
+	fb := NewFieldBuilder(ofb.Name)
+	fb.Merge(ofb.TypeBuilder)
+	tb.Fields = append(tb.Fields, fb)
+}
+
+// withFields makes a shallow copy of tb holding only the fields whose key
+// matches.
+func (tb *TypeBuilder) withFields(match func(string) bool) *TypeBuilder {
+	c := *tb
+	c.Fields = nil
+	for _, fb := range tb.Fields {
+		if match(fb.Name) {
+			c.Fields = append(c.Fields, fb)
+		}
+	}
+
+	return &c
+}
+
+func (tb *TypeBuilder) field(name string) *FieldBuilder {
+	for _, fb := range tb.Fields {
+		if fb.Name == name {
+			return fb
+		}
+	}
+
+	return nil
+}
+
+// isShapeSubsetOf indicates whether every field in tb is also present in
+// other with the same kinds of values.
+func (tb *TypeBuilder) isShapeSubsetOf(other *TypeBuilder) bool {
+	for _, fb := range tb.Fields {
+		ofb := other.field(fb.Name)
+		if ofb == nil {
+			return false
+		}
+		if fb.Fields != nil && ofb.Fields == nil {
+			return false
+		}
+		if fb.Array != nil && ofb.Array == nil {
+			return false
+		}
+		for key := range fb.Primitives {
+			if _, ok := ofb.Primitives[key]; !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 func (tb *TypeBuilder) includeValue(v *bson.Value) {
 	tb.Count++
 	switch v.Type() {
 	case bson.TypeArray:
-		if tb.Array == nil {
-			tb.Array = NewTypeBuilder()
-		}
-		tb.Array.includeArray(v.MutableArray())
+		tb.includeArray(v.MutableArray())
 	case bson.TypeEmbeddedDocument:
-		tb.IncludeDocument(v.MutableDocument())
+		tb.includeDocument(v.MutableDocument())
+	case bson.TypeNull:
+		tb.NullCount++
 	default:
 		tb.includePrimitive(v)
 	}
 }
 
 func (tb *TypeBuilder) includeArray(arr *bson.Array) {
-	tb.Count++
+	length := uint(arr.Len())
+	if tb.ArrayCount == 0 || length < tb.MinArrayLength {
+		tb.MinArrayLength = length
+	}
+	if length > tb.MaxArrayLength {
+		tb.MaxArrayLength = length
+	}
+
+	tb.ArrayCount++
+	if tb.Array == nil {
+		tb.Array = NewTypeBuilder()
+	}
+	if length == 0 {
+		tb.EmptyArrayCount++
+		return
+	}
+
 	iter, _ := arr.Iterator()
-	for iter.Next() {
-		tb.includeValue(iter.Value())
+	for i := 0; iter.Next(); i++ {
+		v := iter.Value()
+		tb.Array.includeValue(v)
+		if i < maxTrackedPositions {
+			if i == len(tb.Positions) {
+				tb.Positions = append(tb.Positions, NewTypeBuilder())
+			}
+			tb.Positions[i].includeValue(v)
+		}
 	}
 }
 
@@ -72,6 +392,28 @@ func (tb *TypeBuilder) includePrimitive(v *bson.Value) {
 	}
 
 	tb.Primitives[name]++
+
+	if v.Type() == bson.TypeString {
+		tb.includeStringValue(v.StringValue(), 1)
+	}
+}
+
+// includeStringValue counts the string value as seen count times, until too
+// many distinct values are seen to track them.
+func (tb *TypeBuilder) includeStringValue(str string, count uint) {
+	if tb.TooManyStringValues {
+		return
+	}
+	if tb.StringValues == nil {
+		tb.StringValues = make(map[string]uint)
+	}
+	if _, ok := tb.StringValues[str]; !ok && len(tb.StringValues) == maxTrackedStringValues {
+		tb.StringValues = nil
+		tb.TooManyStringValues = true
+		return
+	}
+
+	tb.StringValues[str] += count
 }
 
 func mapPrimitiveTypeName(t bson.Type) string {
@@ -83,7 +425,7 @@ func mapPrimitiveTypeName(t bson.Type) string {
 	case bson.TypeDateTime:
 		return "time.Time time"
 	case bson.TypeDecimal128:
-		return "decimal128.Decimal128 github.com/mongodb/mongo-go-driver/bson/decimal128"
+		return decimalTypeName
 	case bson.TypeDouble:
 		return "float64"
 	case bson.TypeInt32:
@@ -96,13 +438,16 @@ func mapPrimitiveTypeName(t bson.Type) string {
 		return "string"
 	case bson.TypeTimestamp:
 		return "time.Time time"
-	case bson.TypeNull:
-		return "null"
 	default:
-		return "*bson.Value github.com/mongodb/mongo-go-driver/bson"
+		return rawTypeName
 	}
 }
 
+const (
+	decimalTypeName = "decimal.Decimal128 github.com/mongodb/mongo-go-driver/bson/decimal"
+	rawTypeName     = "*bson.Value github.com/mongodb/mongo-go-driver/bson"
+)
+
 // NewFieldBuilder makes a FieldBuilder.
 func NewFieldBuilder(name string) *FieldBuilder {
 	return &FieldBuilder{
@@ -116,3 +461,17 @@ type FieldBuilder struct {
 	*TypeBuilder
 	Name string
 }
+
+// NewVariantBuilder makes a VariantBuilder.
+func NewVariantBuilder(value string) *VariantBuilder {
+	return &VariantBuilder{
+		Value:       value,
+		TypeBuilder: NewTypeBuilder(),
+	}
+}
+
+// VariantBuilder builds up the documents sharing a discriminator value.
+type VariantBuilder struct {
+	*TypeBuilder
+	Value string
+}
@@ -0,0 +1,72 @@
+package bsonutil
+
+import (
+	"strconv"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// buildUnion builds a base struct holding the fields common to every variant,
+// along with a struct for each variant holding the rest of its fields.
+func (b *builder) buildUnion(name string, tb *TypeBuilder) *structbuilder.Struct {
+	common := make(map[string]bool)
+	for _, fb := range tb.Fields {
+		common[fb.Name] = true
+		for _, vb := range tb.Variants {
+			if vb.field(fb.Name) == nil {
+				common[fb.Name] = false
+				break
+			}
+		}
+	}
+
+	base := b.buildStruct(name, "", tb.withFields(func(key string) bool {
+		return common[key]
+	}), nil)
+	base.Discriminator = tb.Discriminator
+
+	// variant names are numbered when they would repeat the name of another
+	// struct, as values such as a-b and a_b or a nested struct's name can.
+	taken := make(map[string]struct{})
+	addStructNames(taken, base)
+	for _, vb := range tb.Variants {
+		name := base.Name + naming.ExportedField(vb.Value)
+		unique := name
+		for i := 2; isTaken(taken, naming.Struct(unique)); i++ {
+			unique = name + strconv.Itoa(i)
+		}
+
+		vs := b.buildStruct(unique, "", vb.withFields(func(key string) bool {
+			return !common[key]
+		}), nil)
+		addStructNames(taken, vs)
+		vs.Fields = append([]*structbuilder.Field{{
+			Type: &structbuilder.FieldType{Name: base.Name},
+			Tags: []string{`bson:",inline"`},
+		}}, vs.Fields...)
+
+		base.Variants = append(base.Variants, &structbuilder.Variant{
+			Value:  vb.Value,
+			Struct: vs,
+		})
+	}
+
+	return base
+}
+
+// addStructNames adds the names of the struct and of the structs embedded in
+// its fields.
+func addStructNames(names map[string]struct{}, s *structbuilder.Struct) {
+	names[s.Name] = struct{}{}
+	for _, f := range s.Fields {
+		if es := f.Type.Innermost().EmbeddedStruct; es != nil {
+			addStructNames(names, es)
+		}
+	}
+}
+
+func isTaken(names map[string]struct{}, name string) bool {
+	_, ok := names[name]
+	return ok
+}
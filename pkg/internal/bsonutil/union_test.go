@@ -0,0 +1,101 @@
+package bsonutil
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBuildUnion(t *testing.T) {
+	testCases := []struct {
+		name string
+		docs []string
+		want []string
+	}{
+		{
+			name: "common and variant fields",
+			docs: []string{
+				`{"kind":"click","at":1,"x":2}`,
+				`{"kind":"key","at":1,"code":"a"}`,
+			},
+			want: []string{
+				"Event", "Kind string", "At int64",
+				"EventClick", "Event", "X int64",
+				"EventKey", "Event", "Code string",
+			},
+		},
+		{
+			name: "values giving the same name",
+			docs: []string{
+				`{"kind":"a-b","x":1}`,
+				`{"kind":"a_b","y":1}`,
+			},
+			want: []string{
+				"Event", "Kind string",
+				"EventAB", "Event", "X int64",
+				"EventAB2", "Event", "Y int64",
+			},
+		},
+		{
+			name: "value giving the name of a nested struct",
+			docs: []string{
+				`{"kind":"click","click":{"z":1}}`,
+				`{"kind":"other","click":{"z":1}}`,
+			},
+			want: []string{
+				"Event", "Kind string", "Click struct EventClick", "EventClick", "Z int64",
+				"EventClick2", "Event",
+				"EventOther", "Event",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := describe(buildFromJSON(t, "events", "kind", tc.docs...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTooManyVariants(t *testing.T) {
+	var docs []string
+	for i := 0; i <= maxTrackedVariants; i++ {
+		docs = append(docs, fmt.Sprintf(`{"kind":"k%d","v":%d}`, i, i))
+	}
+
+	s := buildFromJSON(t, "events", "kind", docs...)
+	if len(s.Variants) != 0 {
+		t.Errorf("expected no variants but got %d", len(s.Variants))
+	}
+
+	want := []string{"Event", "Kind string", "V int64"}
+	if got := describe(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestMergeTooManyVariants(t *testing.T) {
+	half := func(offset int) *TypeBuilder {
+		tb := NewTypeBuilder()
+		tb.Discriminator = "kind"
+		for i := 0; i < maxTrackedVariants/2+1; i++ {
+			tb.variant(fmt.Sprintf("k%d", offset+i))
+		}
+		return tb
+	}
+
+	tb := half(0)
+	tb.Merge(half(maxTrackedVariants))
+	if !tb.TooManyVariants || tb.Variants != nil {
+		t.Errorf("expected too many variants but got %d", len(tb.Variants))
+	}
+
+	tb = NewTypeBuilder()
+	tb.Merge(&TypeBuilder{TooManyVariants: true})
+	if !tb.TooManyVariants {
+		t.Errorf("expected too many variants to be merged")
+	}
+}
@@ -1,6 +1,11 @@
 package naming
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/craiggwilson/go-typeproviders/pkg/internal/inflect"
 )
 
@@ -19,14 +24,75 @@ func init() {
 
 // Struct returns a proper name for a struct
 func Struct(name string) string {
-	return inflect.Camelize(inflect.Singularize(name))
+	return exported(inflect.Camelize(inflect.Singularize(identifier(name))))
+}
+
+// StructNames tracks the struct names given to a set of sources, such as
+// files or collections, so that two sources can't generate the same struct.
+type StructNames map[string]string
+
+// Add records the struct named after name for the source, failing when
+// another source already generates it.
+func (n StructNames) Add(source string, name string) error {
+	structName := Struct(name)
+	if other, ok := n[structName]; ok {
+		return fmt.Errorf("%s and %s would both generate %s", other, source, structName)
+	}
+
+	n[structName] = source
+	return nil
 }
 
 // ExportedField returns a proper name for a field.
 func ExportedField(name string) string {
-	return inflect.Camelize(name)
+	return exported(inflect.Camelize(identifier(name)))
+}
+
+// File returns the name of the file holding a struct, without the extension,
+// such as orders for Order. Names Go would take for build constraints, such
+// as user_windows or result_test, get a _gen suffix so that the file is
+// always built.
+func File(name string) string {
+	file := strings.ToLower(inflect.Underscore(inflect.Pluralize(name)))
+	if constrained(file) {
+		file += "_gen"
+	}
+
+	return file
+}
+
+// constrained indicates whether go build only builds the file for some
+// targets, or only for tests, because of its name.
+func constrained(file string) bool {
+	i := strings.LastIndexByte(file, '_')
+	if i < 0 {
+		return false
+	}
+
+	suffix := file[i+1:]
+	_, isOS := knownOS[suffix]
+	_, isArch := knownArch[suffix]
+	return suffix == "test" || isOS || isArch
 }
 
+// knownOS and knownArch are the values of GOOS and GOARCH that go build
+// recognizes in file names, including those it reserves for the future.
+var (
+	knownOS = map[string]struct{}{
+		"aix": {}, "android": {}, "darwin": {}, "dragonfly": {}, "freebsd": {},
+		"hurd": {}, "illumos": {}, "ios": {}, "js": {}, "linux": {}, "nacl": {},
+		"netbsd": {}, "openbsd": {}, "plan9": {}, "solaris": {}, "wasip1": {},
+		"windows": {}, "zos": {},
+	}
+	knownArch = map[string]struct{}{
+		"386": {}, "amd64": {}, "amd64p32": {}, "arm": {}, "armbe": {},
+		"arm64": {}, "arm64be": {}, "loong64": {}, "mips": {}, "mipsle": {},
+		"mips64": {}, "mips64le": {}, "mips64p32": {}, "mips64p32le": {},
+		"ppc": {}, "ppc64": {}, "ppc64le": {}, "riscv": {}, "riscv64": {},
+		"s390": {}, "s390x": {}, "sparc": {}, "sparc64": {}, "wasm": {},
+	}
+)
+
 // Pluralize returns a plural form of the name.
 func Pluralize(name string) string {
 	return inflect.Pluralize(name)
@@ -36,3 +102,25 @@ func Pluralize(name string) string {
 func Singularize(name string) string {
 	return inflect.Singularize(name)
 }
+
+// exported prefixes an X to names which wouldn't be exported Go identifiers,
+// such as those starting with a digit like 2020Log.
+func exported(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	if !unicode.IsUpper(r) {
+		return "X" + name
+	}
+
+	return name
+}
+
+// identifier replaces the characters not allowed in a Go identifier, such as
+// the dots in a collection name, with underscores.
+func identifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
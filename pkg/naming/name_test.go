@@ -0,0 +1,113 @@
+package naming
+
+import "testing"
+
+func TestStructNames(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sources []string
+		wantErr string
+	}{
+		{
+			name:    "distinct",
+			sources: []string{"orders", "users"},
+		},
+		{
+			name:    "singular and plural",
+			sources: []string{"order", "orders"},
+			wantErr: "order and orders would both generate Order",
+		},
+		{
+			name:    "punctuation",
+			sources: []string{"a-b", "a_b"},
+			wantErr: "a-b and a_b would both generate AB",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names := make(StructNames)
+			var err error
+			for _, source := range tc.sources {
+				if err = names.Add(source, source); err != nil {
+					break
+				}
+			}
+
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr):
+				t.Errorf("expected error %q but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStruct(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{name: "orders", want: "Order"},
+		{name: "order_items", want: "OrderItem"},
+		{name: "logs.2020", want: "Logs2020"},
+		{name: "2020_logs", want: "X2020Log"},
+		{name: "9", want: "X9"},
+		{name: "", want: "X"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Struct(tc.name); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExportedField(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{name: "name", want: "Name"},
+		{name: "_id", want: "ID"},
+		{name: "first-name", want: "FirstName"},
+		{name: "1st", want: "X1st"},
+		{name: "2", want: "X2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExportedField(tc.name); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{name: "Order", want: "orders"},
+		{name: "OrderItem", want: "order_items"},
+		{name: "UserWindow", want: "user_windows_gen"},
+		{name: "BuildLinux", want: "build_linuxes"},
+		{name: "Linux", want: "linuxes"},
+		{name: "ResultTest", want: "result_tests"},
+		{name: "CPUArm", want: "cpu_arms"},
+		{name: "Arm64", want: "arm64s"},
+		{name: "OrderID", want: "order_ids"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := File(tc.name); got != tc.want {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
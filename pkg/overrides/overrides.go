@@ -0,0 +1,125 @@
+// Package overrides reads the manual decisions about individual fields that
+// inference should not change, such as a name or a type.
+package overrides
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Override holds the decisions about a single field. Empty settings leave
+// the inferred ones in place.
+type Override struct {
+	// Name is the Go name of the field.
+	Name string `yaml:"name" json:"name"`
+	// Type is the Go type of the field, such as time.Time or []string, and
+	// Import is the path of the package it comes from, if any.
+	Type   string `yaml:"type" json:"type"`
+	Import string `yaml:"import" json:"import"`
+	// Tags replace the values of the named struct tags, adding the tags not
+	// already present. An empty value removes the tag.
+	Tags map[string]string `yaml:"tags" json:"tags"`
+	// Nullable decides whether the field is a pointer.
+	Nullable *bool `yaml:"nullable" json:"nullable"`
+	// Exclude leaves the field out of the struct.
+	Exclude bool `yaml:"exclude" json:"exclude"`
+}
+
+// Set holds the overrides keyed by the dotted path of the field, starting
+// with the name the struct is built from, such as a collection or file name,
+// as in orders.items.price. A path starting with * applies to every struct.
+type Set map[string]*Override
+
+// Load reads a set of overrides, which is JSON when the name ends in .json
+// and YAML otherwise.
+func Load(path string) (Set, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set Set
+	if filepath.Ext(path) == ".json" {
+		// unknown fields are rejected like yaml's, so typos don't go unnoticed.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&set)
+	} else {
+		err = yaml.UnmarshalStrict(data, &set)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for key, o := range set {
+		if o == nil {
+			return nil, fmt.Errorf("%s: %s has no settings", path, key)
+		}
+		if o.Type == "" && o.Import != "" {
+			return nil, fmt.Errorf("%s: %s has an import but no type", path, key)
+		}
+		if o.Import != "" && !strings.Contains(o.Type, ".") {
+			return nil, fmt.Errorf("%s: %s has an import but its type %s isn't qualified by the package", path, key, o.Type)
+		}
+		if !strings.Contains(key, ".") {
+			return nil, fmt.Errorf("%s: %s should be a dotted path starting with a collection or file name", path, key)
+		}
+	}
+
+	return set, nil
+}
+
+// Lookup finds the override for the field at the dotted document path of the
+// struct built from name, or nil if there is none.
+func (s Set) Lookup(name string, docPath string) *Override {
+	if o, ok := s[name+"."+docPath]; ok {
+		return o
+	}
+
+	return s["*."+docPath]
+}
+
+// ApplyTags returns the tags with the overridden ones replaced, added or
+// removed. Tags are written as name:"value".
+func (o *Override) ApplyTags(tags []string) []string {
+	if len(o.Tags) == 0 {
+		return tags
+	}
+
+	applied := make(map[string]struct{})
+	var results []string
+	for _, tag := range tags {
+		name := tag
+		if i := strings.Index(tag, ":"); i >= 0 {
+			name = tag[:i]
+		}
+
+		value, ok := o.Tags[name]
+		if !ok {
+			results = append(results, tag)
+			continue
+		}
+
+		applied[name] = struct{}{}
+		if value != "" {
+			results = append(results, fmt.Sprintf(`%s:"%s"`, name, value))
+		}
+	}
+
+	var added []string
+	for name, value := range o.Tags {
+		if _, ok := applied[name]; !ok && value != "" {
+			added = append(added, fmt.Sprintf(`%s:"%s"`, name, value))
+		}
+	}
+	sort.Strings(added)
+
+	return append(results, added...)
+}
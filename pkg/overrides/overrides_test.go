@@ -0,0 +1,171 @@
+package overrides
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	nullable := false
+
+	testCases := []struct {
+		name     string
+		filename string
+		content  string
+		want     Set
+		wantErr  string
+	}{
+		{
+			name:     "yaml",
+			filename: "overrides.yaml",
+			content:  "orders.createdAt:\n  type: time.Time\n  import: time\n  nullable: false\n",
+			want:     Set{"orders.createdAt": {Type: "time.Time", Import: "time", Nullable: &nullable}},
+		},
+		{
+			name:     "json",
+			filename: "overrides.json",
+			content:  `{"*.note":{"exclude":true},"orders.a":{"tags":{"json":"alpha"}}}`,
+			want:     Set{"*.note": {Exclude: true}, "orders.a": {Tags: map[string]string{"json": "alpha"}}},
+		},
+		{
+			name:     "unknown yaml setting",
+			filename: "overrides.yaml",
+			content:  "orders.a:\n  nulable: true\n",
+			wantErr:  "nulable",
+		},
+		{
+			name:     "unknown json setting",
+			filename: "overrides.json",
+			content:  `{"orders.a":{"nulable":true}}`,
+			wantErr:  "nulable",
+		},
+		{
+			name:     "no settings",
+			filename: "overrides.yaml",
+			content:  "orders.a:\n",
+			wantErr:  "orders.a has no settings",
+		},
+		{
+			name:     "import without a type",
+			filename: "overrides.yaml",
+			content:  "orders.a:\n  import: time\n",
+			wantErr:  "orders.a has an import but no type",
+		},
+		{
+			name:     "import with an unqualified type",
+			filename: "overrides.yaml",
+			content:  "orders.a:\n  type: Time\n  import: time\n",
+			wantErr:  "its type Time isn't qualified by the package",
+		},
+		{
+			name:     "path without a struct name",
+			filename: "overrides.yaml",
+			content:  "a:\n  name: Alpha\n",
+			wantErr:  "a should be a dotted path",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "overrides")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = os.RemoveAll(dir)
+			}()
+
+			path := filepath.Join(dir, tc.filename)
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Load(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q but got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	orders := &Override{Name: "OrderNote"}
+	all := &Override{Exclude: true}
+	set := Set{
+		"orders.note":        orders,
+		"*.note":             all,
+		"orders.items.price": {Type: "float64"},
+	}
+
+	testCases := []struct {
+		name    string
+		docPath string
+		want    *Override
+	}{
+		{name: "orders", docPath: "note", want: orders},
+		{name: "users", docPath: "note", want: all},
+		{name: "orders", docPath: "items.price", want: set["orders.items.price"]},
+		{name: "users", docPath: "items.price"},
+		{name: "orders", docPath: "missing"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name+"."+tc.docPath, func(t *testing.T) {
+			if got := set.Lookup(tc.name, tc.docPath); got != tc.want {
+				t.Errorf("expected %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyTags(t *testing.T) {
+	tags := []string{`bson:"a"`, `json:"a"`}
+
+	testCases := []struct {
+		name string
+		tags map[string]string
+		want []string
+	}{
+		{
+			name: "no tags",
+			want: tags,
+		},
+		{
+			name: "replaced",
+			tags: map[string]string{"json": "alpha,omitempty"},
+			want: []string{`bson:"a"`, `json:"alpha,omitempty"`},
+		},
+		{
+			name: "removed",
+			tags: map[string]string{"json": ""},
+			want: []string{`bson:"a"`},
+		},
+		{
+			name: "added in order",
+			tags: map[string]string{"yaml": "a", "db": "a", "xml": ""},
+			want: []string{`bson:"a"`, `json:"a"`, `db:"a"`, `yaml:"a"`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Override{Tags: tc.tags}
+			if got := o.ApplyTags(tags); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -5,14 +5,23 @@ import (
 	"io"
 
 	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
 	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
-	"github.com/mongodb/mongo-go-driver/bson"
 )
 
 // Config holds information required for configuration mongodb.
 type Config struct {
-	StructName string
-	Input      io.Reader
+	StructName    string
+	Input         io.Reader
+	Discriminator string
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those.
+	TagNames []string
+	// Overrides are the manual decisions about fields, which win over the
+	// inferred ones.
+	Overrides overrides.Set
 }
 
 // NewStructProvider makes a StructProvider.
@@ -29,21 +38,24 @@ type StructProvider struct {
 
 // ProvideStructs implements the generators.StructProvider interface.
 func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
+	s, err := p.ProvideSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bsonutil.BuildSchema(s, p.cfg.TagNames, p.cfg.Overrides)
+}
+
+// ProvideSchema implements the schema.Provider interface.
+func (p *StructProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
 	tb := bsonutil.NewTypeBuilder()
-	for {
-		doc := bson.NewDocument()
-		_, err := doc.ReadFrom(p.cfg.Input)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-
-			return nil, err
-		}
-
-		tb.IncludeDocument(doc)
+	tb.Discriminator = p.cfg.Discriminator
+	if err := tb.IncludeReader(p.cfg.Input); err != nil {
+		return nil, err
 	}
 
-	result := bsonutil.BuildStruct(p.cfg.StructName, tb)
-	return []*structbuilder.Struct{result}, nil
+	return &schema.Schema{
+		Version:     schema.Version,
+		Collections: []*schema.Collection{bsonutil.CollectionSchema(p.cfg.StructName, tb, bsonutil.BuildConfig{}, nil)},
+	}, nil
 }
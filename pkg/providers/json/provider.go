@@ -3,17 +3,30 @@ package json
 import (
 	"context"
 	"io"
-	"io/ioutil"
 
+	"github.com/craiggwilson/go-typeproviders/pkg/extjson"
 	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
 	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
-	"github.com/mongodb/mongo-go-driver/bson"
 )
 
 // Config holds information required for configuration mongodb.
 type Config struct {
-	StructName string
-	Input      io.Reader
+	StructName    string
+	Input         io.Reader
+	Discriminator string
+
+	// Mode is the flavor of Extended JSON in the input. The zero value
+	// detects it.
+	Mode extjson.Mode
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those, or only json in plain mode.
+	TagNames []string
+	// Overrides are the manual decisions about fields, which win over the
+	// inferred ones.
+	Overrides overrides.Set
 }
 
 // NewStructProvider makes a StructProvider.
@@ -30,18 +43,44 @@ type StructProvider struct {
 
 // ProvideStructs implements the generators.StructProvider interface.
 func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
-	jsonString, err := ioutil.ReadAll(p.cfg.Input)
+	s, err := p.ProvideSchema(ctx)
 	if err != nil {
 		return nil, err
 	}
-	doc, err := bson.ParseExtJSONObject(string(jsonString))
-	if err != nil && err != io.EOF {
-		return nil, err
+
+	return bsonutil.BuildSchema(s, p.cfg.TagNames, p.cfg.Overrides)
+}
+
+// ProvideSchema implements the schema.Provider interface.
+func (p *StructProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
+	mode := p.cfg.Mode
+	if mode == "" {
+		mode = extjson.ModeAuto
 	}
 
 	tb := bsonutil.NewTypeBuilder()
-	tb.IncludeDocument(doc)
+	tb.Discriminator = p.cfg.Discriminator
+
+	r := extjson.NewReader(p.cfg.Input, mode)
+	for {
+		doc, err := r.ReadDocument()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		tb.IncludeDocument(doc)
+	}
+
+	cfg := bsonutil.BuildConfig{
+		Plain: mode == extjson.ModePlain,
+	}
 
-	result := bsonutil.BuildStruct(p.cfg.StructName, tb)
-	return []*structbuilder.Struct{result}, nil
+	return &schema.Schema{
+		Version:     schema.Version,
+		Collections: []*schema.Collection{bsonutil.CollectionSchema(p.cfg.StructName, tb, cfg, nil)},
+	}, nil
 }
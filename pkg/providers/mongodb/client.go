@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/core/readpref"
+	"github.com/mongodb/mongo-go-driver/mongo/clientopt"
+)
+
+// disconnectTimeout is how long to wait for the client to disconnect.
+const disconnectTimeout = 5 * time.Second
+
+// clientOptions builds the options for the client from the configuration.
+// Options given in the URI take precedence.
+func (p *StructProvider) clientOptions() ([]clientopt.Option, error) {
+	var opts []clientopt.Option
+
+	if p.cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(p.cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, clientopt.ReadPreference(rp))
+	}
+
+	if p.cfg.TLSCAFile != "" || p.cfg.TLSCertificateKeyFile != "" {
+		opts = append(opts, clientopt.SSL(&clientopt.SSLOpt{
+			Enabled:                  true,
+			CaFile:                   p.cfg.TLSCAFile,
+			ClientCertificateKeyFile: p.cfg.TLSCertificateKeyFile,
+		}))
+	}
+
+	if p.cfg.AuthMechanism != "" {
+		opts = append(opts, clientopt.Auth(clientopt.Credential{
+			AuthMechanism: p.cfg.AuthMechanism,
+		}))
+	}
+
+	if p.cfg.AppName != "" {
+		opts = append(opts, clientopt.AppName(p.cfg.AppName))
+	}
+
+	if p.cfg.ServerSelectionTimeout > 0 {
+		opts = append(opts, clientopt.ServerSelectionTimeout(p.cfg.ServerSelectionTimeout))
+	}
+
+	if p.cfg.OperationTimeout > 0 {
+		opts = append(opts, clientopt.SocketTimeout(p.cfg.OperationTimeout))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+)
+
+// The kinds of collection reported by listCollections.
+const (
+	collectionKind = "collection"
+	viewKind       = "view"
+	timeSeriesKind = "timeseries"
+)
+
+// collectionInfo describes a collection as reported by listCollections.
+type collectionInfo struct {
+	name string
+	kind string
+	// capped is set for capped collections, which keep their documents in
+	// insertion order.
+	capped bool
+
+	// timeField and metaField are only set for time-series collections.
+	timeField string
+	metaField string
+}
+
+// listCollections lists the collections matching the filter, sorted by name.
+func listCollections(ctx context.Context, db *mongo.Database, filter *bson.Document) ([]collectionInfo, error) {
+	cursor, err := db.ListCollections(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if cursor == nil {
+		// the database doesn't exist.
+		return nil, nil
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var infos []collectionInfo
+	for cursor.Next(ctx) {
+		doc := bson.NewDocument()
+		err := cursor.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, parseCollectionInfo(doc))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].name < infos[j].name
+	})
+	return infos, nil
+}
+
+func parseCollectionInfo(doc *bson.Document) collectionInfo {
+	info := collectionInfo{
+		name: lookupString(doc, "name"),
+		kind: lookupString(doc, "type"),
+	}
+	if info.kind == "" {
+		// servers before 3.4 don't report the type.
+		info.kind = collectionKind
+	}
+
+	if v, err := doc.LookupErr("options", "capped"); err == nil {
+		info.capped, _ = v.BooleanOK()
+	}
+
+	if v, err := doc.LookupErr("options", "timeseries"); err == nil {
+		if ts, ok := v.MutableDocumentOK(); ok {
+			info.timeField = lookupString(ts, "timeField")
+			info.metaField = lookupString(ts, "metaField")
+		}
+	}
+
+	return info
+}
+
+func lookupString(doc *bson.Document, key ...string) string {
+	v, err := doc.LookupErr(key...)
+	if err != nil {
+		return ""
+	}
+
+	str, _ := v.StringValueOK()
+	return str
+}
@@ -0,0 +1,42 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+)
+
+// listIndexes lists the indexes on the collection, other than the one on _id.
+func listIndexes(ctx context.Context, coll *mongo.Collection) ([]*structbuilder.Index, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var indexes []*structbuilder.Index
+	for cursor.Next(ctx) {
+		doc := bson.NewDocument()
+		err := cursor.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		index, err := bsonutil.ParseIndex(doc)
+		if err != nil {
+			return nil, err
+		}
+		if index.Name == bsonutil.IDIndexName {
+			continue
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	return indexes, cursor.Err()
+}
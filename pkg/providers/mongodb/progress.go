@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// progressInterval is how often progress is reported.
+const progressInterval = time.Second
+
+func newProgress(w io.Writer, total int64) *progress {
+	return &progress{
+		w:     w,
+		total: total,
+		last:  time.Now(),
+	}
+}
+
+// progress reports the number of documents read. A nil progress reports
+// nothing.
+type progress struct {
+	w     io.Writer
+	total int64
+	count int64
+	last  time.Time
+}
+
+func (pr *progress) increment() {
+	if pr == nil {
+		return
+	}
+
+	pr.count++
+	if time.Since(pr.last) >= progressInterval {
+		pr.report()
+	}
+}
+
+func (pr *progress) done() {
+	if pr == nil {
+		return
+	}
+
+	pr.report()
+	fmt.Fprintln(pr.w)
+}
+
+func (pr *progress) report() {
+	pr.last = time.Now()
+	if pr.total > 0 {
+		fmt.Fprintf(pr.w, "\rread %d of ~%d documents", pr.count, pr.total)
+		return
+	}
+
+	fmt.Fprintf(pr.w, "\rread %d documents", pr.count)
+}
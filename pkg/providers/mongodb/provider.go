@@ -3,11 +3,19 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
 	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
 )
 
 // Config holds information required for configuration mongodb.
@@ -16,6 +24,62 @@ type Config struct {
 	DatabaseName   string
 	CollectionName string
 	SampleSize     uint
+	Discriminator  string
+
+	// Filter limits the documents sampled.
+	Filter *bson.Document
+	// Projection limits the fields of the documents sampled.
+	Projection *bson.Document
+	// RecentBy samples the most recent documents by this field instead of
+	// random ones.
+	RecentBy string
+	// DateField, Since and Until limit the documents sampled to those whose
+	// DateField falls within the window. A zero Since or Until leaves that
+	// side of the window open.
+	DateField string
+	Since     time.Time
+	Until     time.Time
+
+	// BatchSize is the number of documents fetched at a time during a full
+	// collection scan. 0 uses the server's default.
+	BatchSize int32
+	// Progress, when set, receives progress reports during a full collection
+	// scan.
+	Progress io.Writer
+
+	// ReadPreference is the mode used to pick servers to read from, such as
+	// secondaryPreferred. Empty leaves the URI's preference in place.
+	ReadPreference string
+	// TLSCAFile and TLSCertificateKeyFile enable TLS using the certificate
+	// authority and client certificate in the files.
+	TLSCAFile             string
+	TLSCertificateKeyFile string
+	// AuthMechanism is the mechanism used to authenticate, such as
+	// SCRAM-SHA-256 or MONGODB-X509.
+	AuthMechanism string
+	// AppName identifies the connection in the server's logs.
+	AppName string
+	// ServerSelectionTimeout is how long to wait for a suitable server.
+	ServerSelectionTimeout time.Duration
+	// OperationTimeout is how long to wait on any single network operation.
+	OperationTimeout time.Duration
+
+	// Indexes generates an Indexes method returning the indexes deployed on
+	// each collection.
+	Indexes bool
+
+	// Include and Exclude are glob patterns matched against collection names
+	// when generating for a whole database. A collection is used when it
+	// matches any Include pattern, or there are none, and no Exclude pattern.
+	Include []string
+	Exclude []string
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those.
+	TagNames []string
+	// Overrides are the manual decisions about fields, which win over the
+	// inferred ones.
+	Overrides overrides.Set
 }
 
 // NewStructProvider makes a StructProvider.
@@ -32,10 +96,31 @@ type StructProvider struct {
 
 // ProvideStructs implements the generators.StructProvider interface.
 func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
-	client, err := mongo.Connect(ctx, p.cfg.URI)
+	s, err := p.ProvideSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bsonutil.BuildSchema(s, p.cfg.TagNames, p.cfg.Overrides)
+}
+
+// ProvideSchema implements the schema.Provider interface.
+func (p *StructProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
+	opts, err := p.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, p.cfg.URI, opts...)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		// ctx may already be cancelled, so disconnecting gets its own time.
+		disconnectCtx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+		defer cancel()
+		_ = client.Disconnect(disconnectCtx)
+	}()
 
 	db := client.Database(p.cfg.DatabaseName)
 
@@ -43,29 +128,111 @@ func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.S
 		return p.provideFromDatabase(ctx, db)
 	}
 
-	coll := db.Collection(p.cfg.CollectionName)
-	return p.provideFromCollection(ctx, coll)
+	infos, err := listCollections(ctx, db, bson.NewDocument(bson.EC.String("name", p.cfg.CollectionName)))
+	if err != nil {
+		return nil, err
+	}
+
+	info := collectionInfo{name: p.cfg.CollectionName, kind: collectionKind}
+	if len(infos) > 0 {
+		info = infos[0]
+	}
+
+	c, err := p.provideFromCollection(ctx, db.Collection(info.name), info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schema.Schema{Version: schema.Version, Collections: []*schema.Collection{c}}, nil
+}
+
+func (p *StructProvider) provideFromDatabase(ctx context.Context, db *mongo.Database) (*schema.Schema, error) {
+	infos, err := listCollections(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &schema.Schema{Version: schema.Version}
+	names := make(naming.StructNames)
+	for _, info := range infos {
+		included, err := p.includeCollection(info.name)
+		if err != nil {
+			return nil, err
+		}
+		if !included {
+			continue
+		}
+		if err := names.Add("collection "+info.name, info.name); err != nil {
+			return nil, fmt.Errorf("%v; exclude one", err)
+		}
+
+		c, err := p.provideFromCollection(ctx, db.Collection(info.name), info)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %v", info.name, err)
+		}
+
+		s.Collections = append(s.Collections, c)
+	}
+
+	return s, nil
 }
 
-func (p *StructProvider) provideFromDatabase(ctx context.Context, db *mongo.Database) ([]*structbuilder.Struct, error) {
-	return nil, fmt.Errorf("not implemented")
+// includeCollection indicates whether the collection should be used when
+// generating for a whole database. System collections are never used.
+func (p *StructProvider) includeCollection(name string) (bool, error) {
+	if strings.HasPrefix(name, "system.") {
+		return false, nil
+	}
+
+	included := len(p.cfg.Include) == 0
+	for _, pattern := range p.cfg.Include {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			included = true
+			break
+		}
+	}
+
+	for _, pattern := range p.cfg.Exclude {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return false, nil
+		}
+	}
+
+	return included, nil
 }
 
-func (p *StructProvider) provideFromCollection(ctx context.Context, coll *mongo.Collection) ([]*structbuilder.Struct, error) {
-	pipeline := bson.NewArray(
-		bson.VC.DocumentFromElements(
-			bson.EC.SubDocumentFromElements(
-				"$sample",
-				bson.EC.Int64("size", int64(p.cfg.SampleSize)),
-			),
-		),
-	)
-	cursor, err := coll.Aggregate(ctx, pipeline)
+func (p *StructProvider) provideFromCollection(ctx context.Context, coll *mongo.Collection, info collectionInfo) (*schema.Collection, error) {
+	var cursor mongo.Cursor
+	var pr *progress
+	var err error
+	if p.cfg.SampleSize == 0 {
+		pr, err = p.newScanProgress(ctx, coll)
+		if err != nil {
+			return nil, err
+		}
+		cursor, err = p.scan(ctx, coll)
+	} else if p.cfg.RecentBy == "" && (info.kind == viewKind || info.capped) {
+		cursor, err = p.limitedFind(ctx, coll, info)
+	} else {
+		cursor, err = coll.Aggregate(ctx, p.samplePipeline())
+	}
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
 
 	tb := bsonutil.NewTypeBuilder()
+	tb.Discriminator = p.cfg.Discriminator
 
 	for cursor.Next(ctx) {
 		doc := bson.NewDocument()
@@ -75,8 +242,159 @@ func (p *StructProvider) provideFromCollection(ctx context.Context, coll *mongo.
 		}
 
 		tb.IncludeDocument(doc)
+		pr.increment()
+	}
+	pr.done()
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	var cfg bsonutil.BuildConfig
+
+	// views don't have indexes of their own.
+	var indexes []*structbuilder.Index
+	if info.kind != viewKind {
+		indexes, err = listIndexes(ctx, coll)
+		if err != nil {
+			return nil, err
+		}
+		bsonutil.ApplyIndexes(&cfg, indexes)
+	}
+
+	if info.kind == timeSeriesKind {
+		cfg.TimePaths = append(cfg.TimePaths, info.timeField)
+		bsonutil.AddComment(&cfg, info.timeField, "time-series time field")
+		if info.metaField != "" {
+			bsonutil.AddComment(&cfg, info.metaField, "time-series meta field")
+		}
+	}
+
+	if !p.cfg.Indexes {
+		indexes = nil
+	}
+	return bsonutil.CollectionSchema(coll.Name(), tb, cfg, indexes), nil
+}
+
+// filter builds the query limiting the documents read, combining the
+// configured filter with the date window.
+func (p *StructProvider) filter() *bson.Document {
+	var conditions []*bson.Value
+	if p.cfg.Filter != nil && p.cfg.Filter.Len() > 0 {
+		conditions = append(conditions, bson.VC.Document(p.cfg.Filter))
+	}
+
+	if p.cfg.DateField != "" && (!p.cfg.Since.IsZero() || !p.cfg.Until.IsZero()) {
+		window := bson.NewDocument()
+		if !p.cfg.Since.IsZero() {
+			window.Append(bson.EC.DateTime("$gte", toMillis(p.cfg.Since)))
+		}
+		if !p.cfg.Until.IsZero() {
+			window.Append(bson.EC.DateTime("$lt", toMillis(p.cfg.Until)))
+		}
+		conditions = append(conditions, bson.VC.DocumentFromElements(
+			bson.EC.SubDocument(p.cfg.DateField, window),
+		))
+	}
+
+	switch len(conditions) {
+	case 0:
+		return bson.NewDocument()
+	case 1:
+		return conditions[0].MutableDocument()
+	default:
+		return bson.NewDocument(bson.EC.ArrayFromElements("$and", conditions...))
+	}
+}
+
+// scan reads the whole collection, or every document matching the filter.
+func (p *StructProvider) scan(ctx context.Context, coll *mongo.Collection) (mongo.Cursor, error) {
+	return coll.Find(ctx, p.filter(), p.findOptions()...)
+}
+
+// limitedFind reads as many documents as the sample size instead of sampling
+// them. $sample runs a view's whole pipeline before picking documents, and
+// can't use a random cursor on capped collections, so it sorts the whole
+// collection instead. The first documents are read from views and the most
+// recent from capped collections.
+func (p *StructProvider) limitedFind(ctx context.Context, coll *mongo.Collection, info collectionInfo) (mongo.Cursor, error) {
+	opts := append(p.findOptions(), findopt.Limit(int64(p.cfg.SampleSize)))
+	if info.capped {
+		opts = append(opts, findopt.Sort(bson.NewDocument(bson.EC.Int32("$natural", -1))))
 	}
 
-	result := bsonutil.BuildStruct(coll.Name(), tb)
-	return []*structbuilder.Struct{result}, nil
+	return coll.Find(ctx, p.filter(), opts...)
+}
+
+func (p *StructProvider) findOptions() []findopt.Find {
+	var opts []findopt.Find
+	if p.cfg.BatchSize > 0 {
+		opts = append(opts, findopt.BatchSize(p.cfg.BatchSize))
+	}
+	if p.cfg.Projection != nil && p.cfg.Projection.Len() > 0 {
+		opts = append(opts, findopt.Projection(p.cfg.Projection))
+	}
+
+	return opts
+}
+
+// newScanProgress makes the progress for a full collection scan. The total
+// is only known when every document is read.
+func (p *StructProvider) newScanProgress(ctx context.Context, coll *mongo.Collection) (*progress, error) {
+	if p.cfg.Progress == nil {
+		return nil, nil
+	}
+
+	var total int64
+	if p.filter().Len() == 0 {
+		var err error
+		total, err = coll.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newProgress(p.cfg.Progress, total), nil
+}
+
+// samplePipeline builds the aggregation pipeline used to sample documents.
+func (p *StructProvider) samplePipeline() *bson.Array {
+	pipeline := bson.NewArray()
+	if filter := p.filter(); filter.Len() > 0 {
+		pipeline.Append(bson.VC.DocumentFromElements(
+			bson.EC.SubDocument("$match", filter),
+		))
+	}
+
+	if p.cfg.RecentBy != "" {
+		pipeline.Append(
+			bson.VC.DocumentFromElements(
+				bson.EC.SubDocumentFromElements(
+					"$sort",
+					bson.EC.Int32(p.cfg.RecentBy, -1),
+				),
+			),
+			bson.VC.DocumentFromElements(
+				bson.EC.Int64("$limit", int64(p.cfg.SampleSize)),
+			),
+		)
+	} else {
+		pipeline.Append(bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements(
+				"$sample",
+				bson.EC.Int64("size", int64(p.cfg.SampleSize)),
+			),
+		))
+	}
+
+	if p.cfg.Projection != nil && p.cfg.Projection.Len() > 0 {
+		pipeline.Append(bson.VC.DocumentFromElements(
+			bson.EC.SubDocument("$project", p.cfg.Projection),
+		))
+	}
+
+	return pipeline
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
 }
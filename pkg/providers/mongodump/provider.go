@@ -0,0 +1,266 @@
+package mongodump
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/decompress"
+	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/naming"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+const (
+	bsonExt     = ".bson"
+	metadataExt = ".metadata.json"
+	gzipExt     = ".gz"
+)
+
+// Config holds information required for configuration mongodump.
+type Config struct {
+	// Dir is the output directory of mongodump, or one of the database
+	// directories in it. When it holds several databases, the structs are
+	// named after both the database and the collection, such as Db1User.
+	Dir           string
+	Discriminator string
+
+	// Indexes generates an Indexes method returning the indexes recorded in
+	// each collection's metadata.
+	Indexes bool
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those.
+	TagNames []string
+	// Overrides are the manual decisions about fields, which win over the
+	// inferred ones.
+	Overrides overrides.Set
+}
+
+// NewStructProvider makes a StructProvider.
+func NewStructProvider(cfg Config) *StructProvider {
+	return &StructProvider{
+		cfg: cfg,
+	}
+}
+
+// StructProvider provides structs.
+type StructProvider struct {
+	cfg Config
+}
+
+// ProvideStructs implements the generators.StructProvider interface.
+func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
+	s, err := p.ProvideSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bsonutil.BuildSchema(s, p.cfg.TagNames, p.cfg.Overrides)
+}
+
+// ProvideSchema implements the schema.Provider interface.
+func (p *StructProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
+	filenames, err := dumpFiles(p.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// collections of different databases may share a name, so the structs
+	// are named after both when a whole server was dumped.
+	qualify := len(databaseDirs(filenames)) > 1
+
+	// the names are checked up front, before reading any of the files.
+	names := make(naming.StructNames)
+	for _, filename := range filenames {
+		if err := names.Add(filename, structName(filename, qualify)); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &schema.Schema{Version: schema.Version}
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		c, err := p.provideFromFile(filename, qualify)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		s.Collections = append(s.Collections, c)
+	}
+
+	return s, nil
+}
+
+func (p *StructProvider) provideFromFile(filename string, qualify bool) (*schema.Collection, error) {
+	r, err := decompress.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	tb := bsonutil.NewTypeBuilder()
+	tb.Discriminator = p.cfg.Discriminator
+	if err := tb.IncludeReader(r); err != nil {
+		return nil, err
+	}
+
+	name := collectionName(filename)
+
+	var cfg bsonutil.BuildConfig
+	md, err := readMetadata(filepath.Join(filepath.Dir(filename), name+metadataExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []*structbuilder.Index
+	if md != nil {
+		if v, err := md.LookupErr("options", "validator"); err == nil {
+			if validator, ok := v.MutableDocumentOK(); ok {
+				bsonutil.ApplyValidator(&cfg, validator)
+			}
+		}
+
+		indexes, err = parseIndexes(md)
+		if err != nil {
+			return nil, err
+		}
+		bsonutil.ApplyIndexes(&cfg, indexes)
+	}
+
+	if !p.cfg.Indexes {
+		indexes = nil
+	}
+	return bsonutil.CollectionSchema(structName(filename, qualify), tb, cfg, indexes), nil
+}
+
+// structName returns the name the struct of the dumped collection is derived
+// from, qualified by the database when qualify is set.
+func structName(filename string, qualify bool) string {
+	name := collectionName(filename)
+	if qualify {
+		return filepath.Base(filepath.Dir(filename)) + "." + name
+	}
+
+	return name
+}
+
+// dumpFiles finds the collection data files under dir, skipping system
+// collections.
+func dumpFiles(dir string) ([]string, error) {
+	var filenames []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		base := decompress.TrimExt(info.Name())
+		if !strings.HasSuffix(base, bsonExt) || strings.HasPrefix(base, "system.") {
+			return nil
+		}
+
+		filenames = append(filenames, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// databaseDirs returns the distinct directories of the data files, one for
+// each database dumped.
+func databaseDirs(filenames []string) map[string]struct{} {
+	dirs := make(map[string]struct{})
+	for _, filename := range filenames {
+		dirs[filepath.Dir(filename)] = struct{}{}
+	}
+
+	return dirs
+}
+
+// collectionName derives the collection name from the data file's name.
+func collectionName(filename string) string {
+	base := decompress.TrimExt(filepath.Base(filename))
+	return strings.TrimSuffix(base, bsonExt)
+}
+
+// readMetadata reads the metadata mongodump writes next to the data file,
+// which may be compressed. It returns nil when there is none.
+func readMetadata(filename string) (*bson.Document, error) {
+	for _, name := range []string{filename, filename + gzipExt} {
+		r, err := decompress.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		md, err := bson.ParseExtJSONObject(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		return md, nil
+	}
+
+	return nil, nil
+}
+
+// parseIndexes reads the indexes recorded in the metadata, other than the
+// one on _id.
+func parseIndexes(md *bson.Document) ([]*structbuilder.Index, error) {
+	v, err := md.LookupErr("indexes")
+	if err != nil {
+		return nil, nil
+	}
+	specs, ok := v.MutableArrayOK()
+	if !ok {
+		return nil, nil
+	}
+
+	var indexes []*structbuilder.Index
+	iter, _ := specs.Iterator()
+	for iter.Next() {
+		doc, ok := iter.Value().MutableDocumentOK()
+		if !ok {
+			continue
+		}
+
+		index, err := bsonutil.ParseIndex(doc)
+		if err != nil {
+			return nil, err
+		}
+		if index.Name == bsonutil.IDIndexName {
+			continue
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
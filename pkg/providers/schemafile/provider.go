@@ -0,0 +1,64 @@
+package schemafile
+
+import (
+	"context"
+	"io"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/internal/bsonutil"
+	"github.com/craiggwilson/go-typeproviders/pkg/overrides"
+	"github.com/craiggwilson/go-typeproviders/pkg/schema"
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// Config holds information required for configuration schema.
+type Config struct {
+	// Input holds a schema saved by another provider.
+	Input io.Reader
+	// Schema is used instead of reading Input when set.
+	Schema *schema.Schema
+
+	// TagNames are the struct tags given to each field, such as bson and
+	// json. Empty uses both of those.
+	TagNames []string
+	// Overrides are the manual decisions about fields, which win over the
+	// inferred ones.
+	Overrides overrides.Set
+}
+
+// NewStructProvider makes a StructProvider.
+func NewStructProvider(cfg Config) *StructProvider {
+	return &StructProvider{
+		cfg: cfg,
+	}
+}
+
+// StructProvider provides structs.
+type StructProvider struct {
+	cfg Config
+}
+
+// ProvideStructs implements the generators.StructProvider interface.
+func (p *StructProvider) ProvideStructs(ctx context.Context) ([]*structbuilder.Struct, error) {
+	s, err := p.ProvideSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bsonutil.BuildSchema(s, p.cfg.TagNames, p.cfg.Overrides)
+}
+
+// ProvideSchema implements the schema.Provider interface.
+func (p *StructProvider) ProvideSchema(ctx context.Context) (*schema.Schema, error) {
+	if p.cfg.Schema != nil {
+		return p.cfg.Schema, nil
+	}
+
+	return schema.Read(p.cfg.Input)
+}
+
+// Merge merges the collections of src into dst as if the documents of both
+// had been seen together, so that samples taken over many runs build up a
+// complete picture.
+func Merge(dst *schema.Schema, src *schema.Schema) error {
+	return bsonutil.MergeSchema(dst, src)
+}
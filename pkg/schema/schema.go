@@ -0,0 +1,136 @@
+// Package schema holds what inference learned about a set of documents in a
+// form that can be saved as JSON, inspected and edited by hand, and turned
+// into code later without reading the data again.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/craiggwilson/go-typeproviders/pkg/structbuilder"
+)
+
+// Version is the version of the format written. Reading a schema of another
+// version fails.
+const Version = 1
+
+// Provider is the interface that wraps the ProvideSchema method.
+type Provider interface {
+	// ProvideSchema infers the schema of every struct that should be
+	// included.
+	ProvideSchema(ctx context.Context) (*Schema, error)
+}
+
+// Schema holds the collections a set of structs is built from.
+type Schema struct {
+	Version     int           `json:"version"`
+	Collections []*Collection `json:"collections"`
+}
+
+// Collection is the inferred shape of the documents a struct is built from,
+// along with what is known about them beyond the data itself. Paths are the
+// dotted keys of the fields, as in items.price.
+type Collection struct {
+	// Name is the name the struct is derived from, such as a collection or
+	// file name.
+	Name string `json:"name"`
+	Type *Type  `json:"type"`
+
+	// GeoPaths are the paths of fields known to hold GeoJSON.
+	GeoPaths []string `json:"geoPaths,omitempty"`
+	// TimePaths are the paths of fields known to hold dates.
+	TimePaths []string `json:"timePaths,omitempty"`
+	// RequiredPaths are the paths of fields that are always present and
+	// never null.
+	RequiredPaths []string `json:"requiredPaths,omitempty"`
+	// Types are the BSON types of fields, named by their $jsonSchema bsonType
+	// aliases such as long or date. They win over the data.
+	Types map[string]string `json:"types,omitempty"`
+	// Comments are notes attached to fields.
+	Comments map[string]string `json:"comments,omitempty"`
+	// Indexes are the indexes returned by a generated Indexes method.
+	Indexes []*structbuilder.Index `json:"indexes,omitempty"`
+	// Plain indicates that the documents came from ordinary JSON rather than
+	// BSON.
+	Plain bool `json:"plain,omitempty"`
+}
+
+// Type holds the counts of every kind of value seen at one place in the
+// documents. Primitive values are counted by their $jsonSchema bsonType
+// alias, with raw counting the kinds that have no Go type of their own.
+type Type struct {
+	// Count is the number of values seen, including nulls.
+	Count uint `json:"count"`
+	// NullCount is the number of explicit nulls seen.
+	NullCount  uint            `json:"nullCount,omitempty"`
+	Primitives map[string]uint `json:"primitives,omitempty"`
+
+	// StringValues holds the counts of the distinct string values seen,
+	// unless there were too many to track.
+	StringValues        map[string]uint `json:"stringValues,omitempty"`
+	TooManyStringValues bool            `json:"tooManyStringValues,omitempty"`
+
+	// DocumentCount is the number of embedded documents seen, whose fields
+	// are in Fields, or in MapValues when there were too many to track.
+	DocumentCount uint     `json:"documentCount,omitempty"`
+	Fields        []*Field `json:"fields,omitempty"`
+	MapValues     *Type    `json:"mapValues,omitempty"`
+
+	// ArrayCount is the number of arrays seen, whose elements are in Array
+	// and, for the first few indexes, in Positions.
+	ArrayCount      uint    `json:"arrayCount,omitempty"`
+	EmptyArrayCount uint    `json:"emptyArrayCount,omitempty"`
+	MinArrayLength  uint    `json:"minArrayLength,omitempty"`
+	MaxArrayLength  uint    `json:"maxArrayLength,omitempty"`
+	Array           *Type   `json:"array,omitempty"`
+	Positions       []*Type `json:"positions,omitempty"`
+
+	// Discriminator is the key of the field partitioning the documents into
+	// Variants, unless there were too many distinct values to track.
+	Discriminator   string     `json:"discriminator,omitempty"`
+	Variants        []*Variant `json:"variants,omitempty"`
+	TooManyVariants bool       `json:"tooManyVariants,omitempty"`
+}
+
+// Field is a field of a document.
+type Field struct {
+	Name string `json:"name"`
+	*Type
+}
+
+// Variant holds the documents sharing a discriminator value.
+type Variant struct {
+	Value string `json:"value"`
+	*Type
+}
+
+// Read reads a schema written by Write.
+func Read(r io.Reader) (*Schema, error) {
+	var s Schema
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != Version {
+		return nil, fmt.Errorf("unsupported schema version %d", s.Version)
+	}
+	for i, c := range s.Collections {
+		if c == nil || c.Type == nil {
+			return nil, fmt.Errorf("collection %d has no type", i+1)
+		}
+	}
+
+	return &s, nil
+}
+
+// Write writes the schema as indented JSON.
+func (s *Schema) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
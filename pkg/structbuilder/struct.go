@@ -4,9 +4,67 @@ import "strings"
 
 // Struct represents a struct.
 type Struct struct {
-	Name   string
-	Fields []*Field
-	Tags   []string
+	Name   string   `json:"name"`
+	Fields []*Field `json:"fields"`
+	Tags   []string `json:"tags,omitempty"`
+
+	// Recursive indicates that one of the struct's descendants refers back
+	// to it, so it must always be given a name.
+	Recursive bool `json:"recursive,omitempty"`
+	// Tuple indicates that the struct is decoded from a fixed length array,
+	// with one field for each position.
+	Tuple bool `json:"tuple,omitempty"`
+	// Plain indicates that the struct is built for ordinary JSON, so its
+	// methods leave BSON out.
+	Plain bool `json:"plain,omitempty"`
+	// Shared indicates that the struct is common to many fields and is only
+	// written once no matter how many fields use it.
+	Shared bool `json:"shared,omitempty"`
+
+	// Discriminator is the key of the field used to tell the variants apart.
+	Discriminator string `json:"discriminator,omitempty"`
+	// Variants are the structs for each value of the discriminator.
+	Variants []*Variant `json:"variants,omitempty"`
+
+	// Indexes are the indexes on the collection the struct was built from.
+	Indexes []*Index `json:"indexes,omitempty"`
+}
+
+// RequiresName indicates whether the struct must be named instead of
+// embedded.
+func (s *Struct) RequiresName() bool {
+	return s.Recursive || s.Tuple || s.Shared
+}
+
+// Index represents an index on a collection.
+type Index struct {
+	Name   string     `json:"name"`
+	Keys   []IndexKey `json:"keys"`
+	Unique bool       `json:"unique,omitempty"`
+	Sparse bool       `json:"sparse,omitempty"`
+
+	// TTL indicates that documents expire ExpireAfterSeconds after the date
+	// in the indexed field.
+	TTL                bool  `json:"ttl,omitempty"`
+	ExpireAfterSeconds int32 `json:"expireAfterSeconds,omitempty"`
+
+	// Options holds the remaining options, such as partialFilterExpression,
+	// collation or the weights of a text index, as canonical Extended JSON.
+	Options string `json:"options,omitempty"`
+}
+
+// IndexKey is a field covered by an index. Kind holds special index types
+// such as 2dsphere, text or hashed; otherwise Direction holds 1 or -1.
+type IndexKey struct {
+	Field     string `json:"field"`
+	Direction int32  `json:"direction,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+}
+
+// Variant is the struct used for one value of a discriminator.
+type Variant struct {
+	Value  string  `json:"value"`
+	Struct *Struct `json:"struct"`
 }
 
 // QuotedTags gets the tags quoted with a backtick.
@@ -22,28 +80,73 @@ func (s *Struct) QuotedTags() string {
 func (s *Struct) UnembedStructs() []*Struct {
 	results := []*Struct{s}
 	for _, f := range s.Fields {
-		if f.Type.EmbeddedStruct != nil {
-			results = append(results, f.Type.EmbeddedStruct.UnembedStructs()...)
-			f.Type.EmbeddedStruct = nil
+		ft := f.Type.Innermost()
+		if ft.EmbeddedStruct != nil {
+			results = append(results, ft.EmbeddedStruct.UnembedStructs()...)
+			ft.EmbeddedStruct = nil
 		}
 	}
+	for _, v := range s.Variants {
+		results = append(results, v.Struct.UnembedStructs()...)
+	}
+
+	return results
+}
+
+// UnembedRequiredStructs unembeds only the children which must be named,
+// leaving the rest embedded.
+func (s *Struct) UnembedRequiredStructs() []*Struct {
+	results := []*Struct{s}
+	for _, f := range s.Fields {
+		ft := f.Type.Innermost()
+		if ft.EmbeddedStruct != nil {
+			children := ft.EmbeddedStruct.UnembedRequiredStructs()
+			if ft.EmbeddedStruct.RequiresName() {
+				ft.EmbeddedStruct = nil
+				results = append(results, children...)
+			} else {
+				results = append(results, children[1:]...)
+			}
+		}
+	}
+	for _, v := range s.Variants {
+		results = append(results, v.Struct.UnembedRequiredStructs()...)
+	}
 
 	return results
 }
 
 // Field represents a field in a struct.
 type Field struct {
-	Name string
-	Type *FieldType
-	Tags []string
+	Name string     `json:"name"`
+	Type *FieldType `json:"type"`
+	Tags []string   `json:"tags,omitempty"`
 }
 
 // FieldType represents the type of the field including its import path.
 type FieldType struct {
-	ImportPath string
-	Name       string
-	ArrayCount int
-	CanBeNull  bool
+	ImportPath string `json:"importPath,omitempty"`
+	Name       string `json:"name,omitempty"`
+	ArrayCount int    `json:"arrayCount,omitempty"`
+	// ArrayLengths holds the length of each array dimension, outermost first.
+	// A length of 0 indicates a slice.
+	ArrayLengths []int `json:"arrayLengths,omitempty"`
+	CanBeNull    bool  `json:"canBeNull,omitempty"`
+	// Comment is a note about how the type was inferred.
+	Comment string `json:"comment,omitempty"`
+	// MapValue is the type of the values when the type is a map keyed by
+	// strings, in which case the name is unused.
+	MapValue *FieldType `json:"mapValue,omitempty"`
+
+	EmbeddedStruct *Struct `json:"embeddedStruct,omitempty"`
+}
+
+// Innermost returns the type of the values held by maps, or the type itself
+// when it isn't a map.
+func (ft *FieldType) Innermost() *FieldType {
+	for ft.MapValue != nil {
+		ft = ft.MapValue
+	}
 
-	EmbeddedStruct *Struct
+	return ft
 }